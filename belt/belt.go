@@ -1,6 +1,9 @@
 package belt
 
-import "fmt"
+import "errors"
+
+// ErrOutOfBounds is returned when reading past the end of a belt.
+var ErrOutOfBounds = errors.New("out of bounds")
 
 type Belt[T any] struct {
 	input []T
@@ -19,7 +22,7 @@ func NewBelt[T any](input []T) *Belt[T] {
 func (b *Belt[T]) GetNext() (T, error) {
 	var t T
 	if b.Ptr >= b.size {
-		return t, fmt.Errorf("out of bounds")
+		return t, ErrOutOfBounds
 	}
 	token := b.input[b.Ptr]
 	b.Ptr++
@@ -29,7 +32,7 @@ func (b *Belt[T]) GetNext() (T, error) {
 func (b *Belt[T]) Peek() (T, error) {
 	var t T
 	if b.Ptr >= b.size {
-		return t, fmt.Errorf("out of bounds")
+		return t, ErrOutOfBounds
 	}
 	return b.input[b.Ptr], nil
 }
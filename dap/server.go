@@ -0,0 +1,531 @@
+// Package dap is a debug adapter for .bot programs, speaking the Debug
+// Adapter Protocol over a pair of streams.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/danwhitford/toyrobot/internal/wire"
+	"github.com/danwhitford/toyrobot/toyrobot"
+)
+
+// errDisconnected stops the program when the client goes away.
+var errDisconnected = errors.New("debugger disconnected")
+
+// Variable references for the scopes of the only stack frame that has any
+const (
+	refStack = 1
+	refRobot = 2
+)
+
+type mode int
+
+const (
+	modeContinue mode = iota
+	modeStepIn
+	modeNext
+	modeStepOut
+)
+
+// Server debugs one program for one client.
+type Server struct {
+	in *bufio.Reader
+
+	// Guards out and seq, which are used by both the goroutine reading
+	// requests and the one running the program.
+	mu  sync.Mutex
+	out io.Writer
+	seq int
+
+	robot       *toyrobot.Robot
+	path        string
+	program     string
+	code        map[int]bool
+	stopOnEntry bool
+	running     bool
+
+	// Breakpoints as the client set them for each source, which can be
+	// before launch says which source is the program
+	sources map[string][]breakpoint
+	nextID  int
+
+	// Shared between the goroutine reading requests and the program's
+	stateMu     sync.Mutex
+	breakpoints map[int]bool // lines of the program with breakpoints
+	pause       bool
+	quit        bool
+	stopped     bool
+
+	// Only touched by the program's goroutine, or while it is stopped
+	mode     mode
+	from     toyrobot.Step
+	lastLine int
+	lastCol  int
+	started  bool
+	frames   []toyrobot.Step
+	resume   chan bool
+	finished chan struct{}
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:          bufio.NewReader(in),
+		out:         out,
+		breakpoints: make(map[int]bool),
+		sources:     make(map[string][]breakpoint),
+		resume:      make(chan bool),
+		finished:    make(chan struct{}),
+	}
+}
+
+type breakpoint struct {
+	id   int
+	line int
+}
+
+type request struct {
+	Seq       int             `json:"seq"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// Serve handles requests until the client disconnects or closes the input.
+func (s *Server) Serve() error {
+	for {
+		body, err := wire.Read(s.in)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				s.stop()
+				return nil
+			}
+			return err
+		}
+		var req request
+		err = json.Unmarshal(body, &req)
+		if err != nil {
+			return err
+		}
+		result, err := s.handle(req)
+		if err != nil {
+			s.respond(req, false, err.Error(), nil)
+		} else {
+			s.respond(req, true, "", result)
+		}
+		switch req.Command {
+		case "initialize":
+			// The client can send configuration once it's seen this
+			s.event("initialized", nil)
+		case "disconnect", "terminate":
+			return nil
+		}
+	}
+}
+
+func (s *Server) handle(req request) (any, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		var args struct {
+			Program     string `json:"program"`
+			StopOnEntry bool   `json:"stopOnEntry"`
+		}
+		err := json.Unmarshal(req.Arguments, &args)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args.Program, args.StopOnEntry)
+	case "setBreakpoints":
+		var args struct {
+			Source struct {
+				Path string `json:"path"`
+			} `json:"source"`
+			Breakpoints []struct {
+				Line int `json:"line"`
+			} `json:"breakpoints"`
+		}
+		err := json.Unmarshal(req.Arguments, &args)
+		if err != nil {
+			return nil, err
+		}
+		lines := make([]int, len(args.Breakpoints))
+		for i, bp := range args.Breakpoints {
+			lines[i] = bp.Line
+		}
+		return map[string]any{"breakpoints": s.setBreakpoints(args.Source.Path, lines)}, nil
+	case "setExceptionBreakpoints":
+		return map[string]any{"breakpoints": []any{}}, nil
+	case "configurationDone":
+		if s.robot == nil {
+			return nil, fmt.Errorf("nothing has been launched")
+		}
+		if s.running {
+			return nil, fmt.Errorf("the program is already running")
+		}
+		s.running = true
+		go s.run()
+		return nil, nil
+	case "threads":
+		return map[string]any{"threads": []any{map[string]any{"id": 1, "name": "main"}}}, nil
+	case "stackTrace":
+		if !s.isStopped() {
+			return nil, fmt.Errorf("not stopped")
+		}
+		return map[string]any{"stackFrames": s.stackFrames(), "totalFrames": len(s.frames)}, nil
+	case "scopes":
+		return map[string]any{"scopes": []any{
+			map[string]any{"name": "Stack", "variablesReference": refStack, "expensive": false},
+			map[string]any{"name": "Robot", "variablesReference": refRobot, "expensive": false},
+		}}, nil
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		err := json.Unmarshal(req.Arguments, &args)
+		if err != nil {
+			return nil, err
+		}
+		if !s.isStopped() {
+			return nil, fmt.Errorf("not stopped")
+		}
+		return map[string]any{"variables": s.variables(args.VariablesReference)}, nil
+	case "continue":
+		return map[string]any{"allThreadsContinued": true}, s.step(modeContinue)
+	case "next":
+		return nil, s.step(modeNext)
+	case "stepIn":
+		return nil, s.step(modeStepIn)
+	case "stepOut":
+		return nil, s.step(modeStepOut)
+	case "pause":
+		s.stateMu.Lock()
+		s.pause = true
+		s.stateMu.Unlock()
+		return nil, nil
+	case "disconnect", "terminate":
+		s.stop()
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported request %s", req.Command)
+	}
+}
+
+func (s *Server) launch(path string, stopOnEntry bool) error {
+	if s.robot != nil {
+		return fmt.Errorf("a program has already been launched")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s.path = cleanPath(path)
+	s.program, _, _ = toyrobot.SplitGolden(string(content))
+	s.code = make(map[int]bool)
+	tokens, err := (&toyrobot.RobotTokeniser{}).Tokenise(s.program)
+	if err == nil {
+		for _, token := range tokens {
+			s.code[token.Pos.Line] = true
+		}
+	}
+	s.stopOnEntry = stopOnEntry
+	s.robot = toyrobot.NewRobot()
+	s.robot.Output = outputWriter{s}
+	s.robot.Hook = s.hook
+	// The program is the user's own, as when it's run from the command line
+	s.robot.CreateFile = func(path string) (io.WriteCloser, error) { return os.Create(path) }
+
+	// Breakpoints set before launch can only be checked now
+	s.applyBreakpoints()
+	for _, bp := range s.sources[s.path] {
+		s.event("breakpoint", map[string]any{"reason": "changed", "breakpoint": s.describeBreakpoint(s.path, bp)})
+	}
+	return nil
+}
+
+// setBreakpoints replaces the breakpoints in a source. Only those on lines
+// of the launched program with code on them are verified.
+func (s *Server) setBreakpoints(path string, lines []int) []any {
+	path = cleanPath(path)
+	bps := make([]breakpoint, len(lines))
+	for i, line := range lines {
+		s.nextID++
+		bps[i] = breakpoint{id: s.nextID, line: line}
+	}
+	s.sources[path] = bps
+	if path == s.path {
+		s.applyBreakpoints()
+	}
+
+	result := make([]any, len(bps))
+	for i, bp := range bps {
+		result[i] = s.describeBreakpoint(path, bp)
+	}
+	return result
+}
+
+// applyBreakpoints makes the breakpoints set in the launched program the
+// ones the program stops at.
+func (s *Server) applyBreakpoints() {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	s.breakpoints = make(map[int]bool)
+	for _, bp := range s.sources[s.path] {
+		s.breakpoints[bp.line] = true
+	}
+}
+
+func (s *Server) describeBreakpoint(path string, bp breakpoint) map[string]any {
+	desc := map[string]any{"id": bp.id, "line": bp.line, "verified": false}
+	switch {
+	case s.robot == nil:
+		desc["message"] = "no program has been launched yet"
+	case path != s.path:
+		desc["message"] = "not in the program being debugged"
+	case !s.code[bp.line]:
+		desc["message"] = "no code on this line"
+	default:
+		desc["verified"] = true
+	}
+	return desc
+}
+
+// cleanPath makes paths to the same file from the client and from launch
+// compare equal.
+func cleanPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
+
+// run runs the program, reporting how it finished.
+func (s *Server) run() {
+	defer close(s.finished)
+	err := s.robot.RunProgram(s.program)
+	if errors.Is(err, errDisconnected) {
+		return
+	}
+	exitCode := 0
+	if err != nil {
+		s.event("output", map[string]any{"category": "stderr", "output": err.Error() + "\n"})
+		exitCode = 1
+	}
+	s.event("exited", map[string]any{"exitCode": exitCode})
+	s.event("terminated", nil)
+}
+
+// hook runs before every instruction and waits for the client while the
+// program is stopped.
+func (s *Server) hook(step toyrobot.Step) error {
+	if step.Depth < len(s.frames) {
+		s.frames = s.frames[:step.Depth]
+	}
+	s.frames = append(s.frames, step)
+
+	s.stateMu.Lock()
+	if s.quit {
+		s.stateMu.Unlock()
+		return errDisconnected
+	}
+	reason := s.stopReason(step)
+	if step.HasPos {
+		s.lastLine, s.lastCol = step.Pos.Line, step.Pos.Col
+	}
+	s.stopped = reason != ""
+	s.stateMu.Unlock()
+	if reason == "" {
+		return nil
+	}
+
+	s.event("stopped", map[string]any{"reason": reason, "threadId": 1, "allThreadsStopped": true})
+	ok := <-s.resume
+	if !ok {
+		return errDisconnected
+	}
+	s.from = step
+	return nil
+}
+
+// stopReason says why the program should stop before step, or "" if it
+// shouldn't. stateMu must be held.
+func (s *Server) stopReason(step toyrobot.Step) string {
+	if !s.started {
+		s.started = true
+		if s.stopOnEntry {
+			return "entry"
+		}
+	}
+	if s.pause {
+		s.pause = false
+		return "pause"
+	}
+	// A breakpoint stops when the program arrives at its line, including
+	// when a loop goes back along the line
+	arrived := step.Pos.Line != s.lastLine || step.Pos.Col <= s.lastCol
+	if step.HasPos && arrived && s.breakpoints[step.Pos.Line] {
+		return "breakpoint"
+	}
+
+	// Stepping stops at the next line rather than the next instruction
+	moved := step.Depth != s.from.Depth || step.HasPos && step.Pos.Line != s.from.Pos.Line
+	switch s.mode {
+	case modeStepIn:
+		if moved {
+			return "step"
+		}
+	case modeNext:
+		if moved && step.Depth <= s.from.Depth {
+			return "step"
+		}
+	case modeStepOut:
+		if step.Depth < s.from.Depth {
+			return "step"
+		}
+	}
+	return ""
+}
+
+func (s *Server) isStopped() bool {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.stopped
+}
+
+// step resumes a stopped program.
+func (s *Server) step(m mode) error {
+	s.stateMu.Lock()
+	if !s.stopped {
+		s.stateMu.Unlock()
+		return fmt.Errorf("not stopped")
+	}
+	s.stopped = false
+	s.stateMu.Unlock()
+	s.mode = m
+	s.resume <- true
+	return nil
+}
+
+// stop ends the program if it's running.
+func (s *Server) stop() {
+	if !s.running {
+		return
+	}
+	s.stateMu.Lock()
+	s.quit = true
+	stopped := s.stopped
+	s.stopped = false
+	s.stateMu.Unlock()
+	if stopped {
+		s.resume <- false
+	}
+	<-s.finished
+}
+
+func (s *Server) stackFrames() []any {
+	lines := strings.Split(s.program, "\n")
+	frames := make([]any, 0, len(s.frames))
+	for i := len(s.frames) - 1; i >= 0; i-- {
+		step := s.frames[i]
+		name := "main"
+		if i > 0 {
+			name = fmt.Sprintf("quotation %d", i)
+		}
+		frame := map[string]any{
+			"id":     i + 1,
+			"name":   name,
+			"line":   0,
+			"column": 0,
+		}
+		if step.HasPos {
+			frame["line"] = step.Pos.Line
+			frame["column"] = step.Pos.Col
+			frame["source"] = map[string]any{"path": s.path}
+			if step.Pos.Line <= len(lines) {
+				frame["name"] = fmt.Sprintf("%s: %s", name, strings.TrimSpace(lines[step.Pos.Line-1]))
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func (s *Server) variables(ref int) []any {
+	vars := make([]any, 0)
+	variable := func(name, value, typ string) {
+		vars = append(vars, map[string]any{"name": name, "value": value, "type": typ, "variablesReference": 0})
+	}
+	r := s.robot
+	switch ref {
+	case refStack:
+		// Top of the stack first
+		stack := *r.RobotValueStack
+		for i := len(stack) - 1; i >= 0; i-- {
+			variable(fmt.Sprint(len(stack)-1-i), stack[i].Literal(), stack[i].Type.String())
+		}
+	case refRobot:
+		variable("Placed", fmt.Sprint(r.Placed), "bool")
+		if r.Placed {
+			variable("X", fmt.Sprint(r.X), "int")
+			variable("Y", fmt.Sprint(r.Y), "int")
+			variable("F", r.F.String(), "Direction")
+		}
+	}
+	return vars
+}
+
+func (s *Server) respond(req request, success bool, message string, body any) {
+	msg := map[string]any{
+		"type":        "response",
+		"request_seq": req.Seq,
+		"command":     req.Command,
+		"success":     success,
+	}
+	if message != "" {
+		msg["message"] = message
+	}
+	if body != nil {
+		msg["body"] = body
+	}
+	s.send(msg)
+}
+
+func (s *Server) event(name string, body any) {
+	msg := map[string]any{"type": "event", "event": name}
+	if body != nil {
+		msg["body"] = body
+	}
+	s.send(msg)
+}
+
+func (s *Server) send(msg map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	msg["seq"] = s.seq
+	wire.Write(s.out, msg)
+}
+
+// outputWriter sends what the program prints to the client.
+type outputWriter struct {
+	s *Server
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	w.s.event("output", map[string]any{"category": "stdout", "output": string(p)})
+	return len(p), nil
+}
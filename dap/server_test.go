@@ -0,0 +1,315 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danwhitford/toyrobot/internal/wire"
+	"github.com/google/go-cmp/cmp"
+)
+
+// client drives a server the way an editor would.
+type client struct {
+	t   *testing.T
+	in  io.Writer
+	out *bufio.Reader
+	seq int
+
+	// The program that breakpoints are set in
+	path string
+}
+
+func newClient(t *testing.T) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- NewServer(inR, outW).Serve()
+		outW.Close()
+	}()
+	t.Cleanup(func() {
+		inW.Close()
+		err := <-done
+		if err != nil {
+			t.Error(err)
+		}
+	})
+	return &client{t: t, in: inW, out: bufio.NewReader(outR)}
+}
+
+// request sends a request and returns the body of its response, along with
+// the events that came before it.
+func (c *client) request(command string, args any) (map[string]any, []string) {
+	msg, events := c.send(command, args)
+	if msg["success"] != true {
+		c.t.Fatalf("bad response to %s: %v", command, msg)
+	}
+	body, _ := msg["body"].(map[string]any)
+	return body, events
+}
+
+// requestError sends a request that should fail and returns its message.
+func (c *client) requestError(command string, args any) string {
+	msg, _ := c.send(command, args)
+	if msg["success"] != false {
+		c.t.Fatalf("%s should have failed: %v", command, msg)
+	}
+	return fmt.Sprint(msg["message"])
+}
+
+func (c *client) send(command string, args any) (map[string]any, []string) {
+	c.seq++
+	err := wire.Write(c.in, map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var events []string
+	for {
+		msg := c.read()
+		if msg["type"] == "event" {
+			events = append(events, describe(msg))
+			continue
+		}
+		if msg["request_seq"] != float64(c.seq) {
+			c.t.Fatalf("bad response to %s: %v", command, msg)
+		}
+		return msg, events
+	}
+}
+
+// waitFor reads events up to and including the named one.
+func (c *client) waitFor(event string) []string {
+	var events []string
+	for {
+		msg := c.read()
+		events = append(events, describe(msg))
+		if msg["event"] == event {
+			return events
+		}
+	}
+}
+
+func (c *client) read() map[string]any {
+	body, err := wire.Read(c.out)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var msg map[string]any
+	err = json.Unmarshal(body, &msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+// describe summarises an event for comparing in tests.
+func describe(msg map[string]any) string {
+	body, _ := msg["body"].(map[string]any)
+	switch msg["event"] {
+	case "stopped":
+		return fmt.Sprintf("stopped %s", body["reason"])
+	case "output":
+		return fmt.Sprintf("output %q", body["output"])
+	case "exited":
+		return fmt.Sprintf("exited %v", body["exitCode"])
+	case "breakpoint":
+		bp := body["breakpoint"].(map[string]any)
+		return fmt.Sprintf("breakpoint %s %v %v", body["reason"], bp["line"], bp["verified"])
+	}
+	return fmt.Sprint(msg["event"])
+}
+
+func (c *client) where() string {
+	body, _ := c.request("stackTrace", map[string]any{"threadId": 1})
+	frames := body["stackFrames"].([]any)
+	where := ""
+	for _, f := range frames {
+		frame := f.(map[string]any)
+		where += fmt.Sprintf("%v:%v ", frame["line"], frame["column"])
+	}
+	return where
+}
+
+func launch(t *testing.T, program string, stopOnEntry bool, breakpoints ...int) *client {
+	c := initialize(t, program)
+	c.request("launch", map[string]any{"program": c.path, "stopOnEntry": stopOnEntry})
+	c.setBreakpoints(breakpoints...)
+	c.request("configurationDone", nil)
+	return c
+}
+
+// initialize starts a session for a program without launching it.
+func initialize(t *testing.T, program string) *client {
+	c := newClient(t)
+	c.path = writeProgram(t, program)
+	_, events := c.request("initialize", map[string]any{"adapterID": "toyrobot"})
+	if len(events) > 0 {
+		t.Fatalf("events before initialize response: %v", events)
+	}
+	if got := c.waitFor("initialized"); len(got) != 1 {
+		t.Fatalf("expected initialized event, got %v", got)
+	}
+	return c
+}
+
+func writeProgram(t *testing.T, program string) string {
+	path := filepath.Join(t.TempDir(), "test.bot")
+	err := os.WriteFile(path, []byte(program), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func (c *client) setBreakpoints(lines ...int) []any {
+	return c.setBreakpointsIn(c.path, lines...)
+}
+
+// setBreakpointsIn sets breakpoints in a source, returning whether each was
+// verified.
+func (c *client) setBreakpointsIn(path string, lines ...int) []any {
+	bps := make([]any, len(lines))
+	for i, line := range lines {
+		bps[i] = map[string]any{"line": line}
+	}
+	body, _ := c.request("setBreakpoints", map[string]any{"source": map[string]any{"path": path}, "breakpoints": bps})
+	verified := make([]any, len(lines))
+	for i, bp := range body["breakpoints"].([]any) {
+		verified[i] = bp.(map[string]any)["verified"]
+	}
+	return verified
+}
+
+func TestBreakpointAndVariables(t *testing.T) {
+	c := launch(t, "0 0 NORTH PLACE\n1 2 +\n3 { MOVE } TIMES\n.\n", false, 3)
+	if diff := cmp.Diff([]string{"stopped breakpoint"}, c.waitFor("stopped")); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+	if got := c.where(); got != "3:1 " {
+		t.Errorf("stopped at %s, want 3:1", got)
+	}
+
+	body, _ := c.request("variables", map[string]any{"variablesReference": refStack})
+	want := []any{map[string]any{"name": "0", "value": "3", "type": "T_INT", "variablesReference": 0.0}}
+	if diff := cmp.Diff(want, body["variables"]); diff != "" {
+		t.Errorf("stack mismatch (-want +got):\n%s", diff)
+	}
+
+	// Otherwise the breakpoint stops in the loop on line 3
+	c.setBreakpoints()
+	c.request("next", map[string]any{"threadId": 1})
+	c.waitFor("stopped")
+	if got := c.where(); got != "4:1 " {
+		t.Errorf("next stopped at %s, want 4:1", got)
+	}
+	body, _ = c.request("variables", map[string]any{"variablesReference": refRobot})
+	want = []any{
+		map[string]any{"name": "Placed", "value": "true", "type": "bool", "variablesReference": 0.0},
+		map[string]any{"name": "X", "value": "0", "type": "int", "variablesReference": 0.0},
+		map[string]any{"name": "Y", "value": "3", "type": "int", "variablesReference": 0.0},
+		map[string]any{"name": "F", "value": "NORTH", "type": "Direction", "variablesReference": 0.0},
+	}
+	if diff := cmp.Diff(want, body["variables"]); diff != "" {
+		t.Errorf("robot mismatch (-want +got):\n%s", diff)
+	}
+
+	c.request("continue", map[string]any{"threadId": 1})
+	if diff := cmp.Diff([]string{`output "3\n"`, "exited 0", "terminated"}, c.waitFor("terminated")); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+	c.request("disconnect", nil)
+}
+
+func TestStepping(t *testing.T) {
+	c := launch(t, "2 {\n  1 DROP\n} TIMES\nXX\n", true)
+	c.waitFor("stopped")
+	want := []string{
+		"1:1 ",
+		"3:3 ",     // TIMES, as pushing the quotation is on the same line
+		"2:3 3:3 ", // into the quotation, which runs twice on the same line
+		"4:1 ",
+	}
+	got := []string{c.where()}
+	for i := 0; i < 3; i++ {
+		c.request("stepIn", map[string]any{"threadId": 1})
+		c.waitFor("stopped")
+		got = append(got, c.where())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("stepIn mismatch (-want +got):\n%s", diff)
+	}
+	c.request("disconnect", nil)
+}
+
+func TestDisconnectWhileStopped(t *testing.T) {
+	c := launch(t, "MOVE\nMOVE\n", true)
+	c.waitFor("stopped")
+	c.request("disconnect", nil)
+}
+
+func TestBreakpointInLoop(t *testing.T) {
+	c := launch(t, "0 0 NORTH PLACE\n3 { MOVE } TIMES\nREPORT\n", false, 2)
+	var got []string
+	for i := 0; i < 4; i++ {
+		c.waitFor("stopped")
+		got = append(got, c.where())
+		c.request("continue", map[string]any{"threadId": 1})
+	}
+	// Arriving at the line, then each time round the loop
+	want := []string{"2:1 ", "2:5 2:12 ", "2:5 2:12 ", "2:5 2:12 "}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("stops mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{`output "0,3,NORTH\n"`, "exited 0", "terminated"}, c.waitFor("terminated")); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+	c.request("disconnect", nil)
+}
+
+func TestRepeatedLaunch(t *testing.T) {
+	path := writeProgram(t, "MOVE\n")
+	c := launch(t, "MOVE\nMOVE\n", true)
+	c.waitFor("stopped")
+	if got := c.requestError("configurationDone", nil); got != "the program is already running" {
+		t.Errorf("second configurationDone gave %q", got)
+	}
+	if got := c.requestError("launch", map[string]any{"program": path}); got != "a program has already been launched" {
+		t.Errorf("second launch gave %q", got)
+	}
+	c.request("disconnect", nil)
+}
+
+func TestBreakpointsBeforeLaunch(t *testing.T) {
+	c := initialize(t, "0 0 NORTH PLACE\nMOVE\n\nREPORT\n")
+	if got := c.setBreakpoints(2, 3); !cmp.Equal(got, []any{false, false}) {
+		t.Errorf("breakpoints before launch verified as %v, want neither", got)
+	}
+	// Breakpoints in another file mustn't stop the program
+	other := writeProgram(t, "MOVE\nMOVE\nMOVE\nMOVE\n")
+	if got := c.setBreakpointsIn(other, 4); !cmp.Equal(got, []any{false}) {
+		t.Errorf("breakpoint in another file verified as %v", got)
+	}
+
+	_, events := c.request("launch", map[string]any{"program": c.path})
+	if diff := cmp.Diff([]string{"breakpoint changed 2 true", "breakpoint changed 3 false"}, events); diff != "" {
+		t.Errorf("events on launch mismatch (-want +got):\n%s", diff)
+	}
+	if got := c.setBreakpointsIn(other, 4); !cmp.Equal(got, []any{false}) {
+		t.Errorf("breakpoint in another file verified as %v after launch", got)
+	}
+	c.request("configurationDone", nil)
+	c.waitFor("stopped")
+	if got := c.where(); got != "2:1 " {
+		t.Errorf("stopped at %s, want 2:1", got)
+	}
+	c.request("continue", map[string]any{"threadId": 1})
+	if diff := cmp.Diff([]string{`output "0,1,NORTH\n"`, "exited 0", "terminated"}, c.waitFor("terminated")); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+	c.request("disconnect", nil)
+}
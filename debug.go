@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danwhitford/toyrobot/toyrobot"
+)
+
+var errQuit = errors.New("quit")
+
+type debugMode int
+
+const (
+	modeStep debugMode = iota
+	modeNext
+	modeOut
+	modeContinue
+)
+
+// debugger stops a running program at breakpoints and between steps and
+// takes commands from the user.
+type debugger struct {
+	robot *toyrobot.Robot
+	lines []string
+	in    *bufio.Scanner
+	out   io.Writer
+
+	mode      debugMode
+	nextDepth int
+	lastLine  int
+	lastCol   int
+
+	wordBreaks map[string]bool
+	lineBreaks map[int]bool
+}
+
+func runDebug(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: toyrobot debug file.bot")
+		return 2
+	}
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	program, _, _ := toyrobot.SplitGolden(string(content))
+	return newDebugger(program, os.Stdin, os.Stdout).run(program)
+}
+
+func newDebugger(program string, in io.Reader, out io.Writer) *debugger {
+	d := &debugger{
+		robot:      toyrobot.NewRobot(),
+		lines:      strings.Split(program, "\n"),
+		in:         bufio.NewScanner(in),
+		out:        out,
+		wordBreaks: make(map[string]bool),
+		lineBreaks: make(map[int]bool),
+	}
+	d.robot.Output = out
+	d.robot.Hook = d.hook
+	return d
+}
+
+// run runs the program under the debugger, returning the exit status.
+func (d *debugger) run(program string) int {
+	fmt.Fprintln(d.out, "Type help for a list of commands.")
+	err := d.robot.RunProgram(program)
+	switch {
+	case errors.Is(err, errQuit):
+		return 0
+	case err != nil:
+		fmt.Fprintln(d.out, "error:", err)
+		return 1
+	}
+	fmt.Fprintln(d.out, "program finished")
+	return 0
+}
+
+func (d *debugger) hook(step toyrobot.Step) error {
+	if !d.shouldStop(step) {
+		return nil
+	}
+	d.mode = modeContinue
+	d.showStep(step)
+	for {
+		fmt.Fprint(d.out, "(debug) ")
+		if !d.in.Scan() {
+			return errQuit
+		}
+		fields := strings.Fields(d.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "s", "step":
+			d.mode = modeStep
+			return nil
+		case "n", "next":
+			d.mode = modeNext
+			d.nextDepth = step.Depth
+			return nil
+		case "o", "out":
+			d.mode = modeOut
+			d.nextDepth = step.Depth
+			return nil
+		case "c", "continue":
+			return nil
+		case "b", "break":
+			d.addBreaks(fields[1:])
+		case "d", "delete":
+			d.deleteBreaks(fields[1:])
+		case "p", "print":
+			d.printState()
+		case "l", "list":
+			d.showStep(step)
+		case "q", "quit":
+			return errQuit
+		case "h", "help":
+			fmt.Fprintln(d.out, `step, s          run one instruction, going into quotations
+next, n          run one instruction, stepping over quotations
+out, o           run until the current quotation returns
+continue, c      run until a breakpoint
+break, b [WORD|LINE]...
+                 stop before a word or at a source line, or list breakpoints
+delete, d [WORD|LINE]...
+                 remove breakpoints, or all of them
+print, p         show the value stack and the robot
+list, l          show where the program is stopped
+quit, q          stop the program`)
+		default:
+			fmt.Fprintf(d.out, "unknown command %q, type help for a list of commands\n", fields[0])
+		}
+	}
+}
+
+func (d *debugger) shouldStop(step toyrobot.Step) bool {
+	line, col := 0, 0
+	if step.HasPos {
+		line, col = step.Pos.Line, step.Pos.Col
+	}
+	// Going back along the same line is a loop arriving at it again
+	newLine := line != d.lastLine || col <= d.lastCol
+	d.lastLine, d.lastCol = line, col
+
+	switch {
+	case d.mode == modeStep:
+		return true
+	case d.mode == modeNext && step.Depth <= d.nextDepth:
+		return true
+	case d.mode == modeOut && step.Depth < d.nextDepth:
+		return true
+	case step.Op == toyrobot.OP_EXEC_WORD && d.wordBreaks[step.Word]:
+		return true
+	case newLine && d.lineBreaks[line]:
+		return true
+	}
+	return false
+}
+
+func (d *debugger) showStep(step toyrobot.Step) {
+	what := step.Word
+	if step.Op == toyrobot.OP_PUSH_VAL {
+		what = "push " + step.Value.Literal()
+	}
+	if !step.HasPos {
+		fmt.Fprintf(d.out, "@%d: %s\n", step.Offset, what)
+		return
+	}
+	fmt.Fprintf(d.out, "%s: %s\n", step.Pos, what)
+	if step.Pos.Line <= len(d.lines) {
+		fmt.Fprintf(d.out, "%4d | %s\n", step.Pos.Line, d.lines[step.Pos.Line-1])
+		fmt.Fprintf(d.out, "     | %s^\n", strings.Repeat(" ", step.Pos.Col-1))
+	}
+}
+
+func (d *debugger) addBreaks(args []string) {
+	if len(args) == 0 {
+		words := make([]string, 0, len(d.wordBreaks))
+		for word := range d.wordBreaks {
+			words = append(words, word)
+		}
+		sort.Strings(words)
+		for _, word := range words {
+			fmt.Fprintf(d.out, "break on word %s\n", word)
+		}
+		lines := make([]int, 0, len(d.lineBreaks))
+		for line := range d.lineBreaks {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+		for _, line := range lines {
+			fmt.Fprintf(d.out, "break at line %d\n", line)
+		}
+		return
+	}
+	for _, arg := range args {
+		if line, err := strconv.Atoi(arg); err == nil {
+			d.lineBreaks[line] = true
+		} else {
+			d.wordBreaks[strings.ToUpper(arg)] = true
+		}
+	}
+}
+
+func (d *debugger) deleteBreaks(args []string) {
+	if len(args) == 0 {
+		d.wordBreaks = make(map[string]bool)
+		d.lineBreaks = make(map[int]bool)
+		return
+	}
+	for _, arg := range args {
+		if line, err := strconv.Atoi(arg); err == nil {
+			delete(d.lineBreaks, line)
+		} else {
+			delete(d.wordBreaks, strings.ToUpper(arg))
+		}
+	}
+}
+
+func (d *debugger) printState() {
+	r := d.robot
+	if r.Placed {
+		fmt.Fprintf(d.out, "robot: X=%d Y=%d F=%s\n", r.X, r.Y, r.F)
+	} else {
+		fmt.Fprintln(d.out, "robot: not placed")
+	}
+	fmt.Fprintf(d.out, "stack: %d values\n", len(*r.RobotValueStack))
+	for i, v := range *r.RobotValueStack {
+		fmt.Fprintf(d.out, "  %d: %s %s\n", i, v.Type, v.Literal())
+	}
+}
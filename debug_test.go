@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// A loop on one line, so breakpoints have to notice it coming round again
+const debugProgram = `0 0 NORTH PLACE
+3 { MOVE } TIMES
+REPORT`
+
+var stopLine = regexp.MustCompile(`^\d+:\d+: .*`)
+
+// debugStops runs debugProgram under the debugger with the given commands,
+// returning where it stopped.
+func debugStops(t *testing.T, commands ...string) []string {
+	t.Helper()
+	var out bytes.Buffer
+	in := strings.NewReader(strings.Join(commands, "\n") + "\n")
+	code := newDebugger(debugProgram, in, &out).run(debugProgram)
+	if code != 0 {
+		t.Fatalf("debugger exited with %d:\n%s", code, out.String())
+	}
+	var stops []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		// Prompts come before the next stop on the same line
+		for strings.HasPrefix(line, "(debug) ") {
+			line = strings.TrimPrefix(line, "(debug) ")
+		}
+		if stopLine.MatchString(line) {
+			stops = append(stops, line)
+		}
+	}
+	return stops
+}
+
+func TestDebugger(t *testing.T) {
+	table := []struct {
+		name     string
+		commands []string
+		want     []string
+	}{
+		{
+			"breakpoint",
+			[]string{"b 2", "c", "c", "c", "c", "c"},
+			[]string{"1:1: push 0", "2:1: push 3", "2:5: MOVE", "2:5: MOVE", "2:5: MOVE"},
+		},
+		{
+			"word breakpoint",
+			[]string{"b report", "c", "c"},
+			[]string{"1:1: push 0", "3:1: REPORT"},
+		},
+		{
+			"step over",
+			[]string{"b 2", "c", "n", "n", "d", "n", "c"},
+			[]string{"1:1: push 0", "2:1: push 3", "2:3: push { MOVE }", "2:12: TIMES", "3:1: REPORT"},
+		},
+		{
+			"step out",
+			[]string{"b 2", "c", "n", "n", "s", "d", "o", "c"},
+			[]string{"1:1: push 0", "2:1: push 3", "2:3: push { MOVE }", "2:12: TIMES", "2:5: MOVE", "3:1: REPORT"},
+		},
+	}
+	for _, tst := range table {
+		got := debugStops(t, tst.commands...)
+		if diff := cmp.Diff(tst.want, got); diff != "" {
+			t.Errorf("%s: stops mismatch (-want +got):\n%s", tst.name, diff)
+		}
+	}
+}
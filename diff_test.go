@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	table := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{"no change", "a b c", "a b c", ""},
+		{
+			"single hunk",
+			"a b c d e f g h",
+			"a b X d e f g h",
+			`--- expected
++++ actual
+@@ -1,6 +1,6 @@
+ a
+ b
+-c
++X
+ d
+ e
+ f
+`,
+		},
+		{
+			"two far apart hunks",
+			"1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20",
+			"1 X 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 Y 20",
+			`--- expected
++++ actual
+@@ -1,5 +1,5 @@
+ 1
+-2
++X
+ 3
+ 4
+ 5
+@@ -16,5 +16,5 @@
+ 16
+ 17
+ 18
+-19
++Y
+ 20
+`,
+		},
+		{
+			"close hunks merge",
+			"1 2 3 4 5 6 7 8 9",
+			"1 X 3 4 5 6 7 Y 9",
+			`--- expected
++++ actual
+@@ -1,9 +1,9 @@
+ 1
+-2
++X
+ 3
+ 4
+ 5
+ 6
+ 7
+-8
++Y
+ 9
+`,
+		},
+		{
+			"added at end",
+			"a b c d e",
+			"a b c d e f",
+			`--- expected
++++ actual
+@@ -3,3 +3,4 @@
+ c
+ d
+ e
++f
+`,
+		},
+		{
+			"removed at end",
+			"a b c d e f",
+			"a b c d e",
+			`--- expected
++++ actual
+@@ -3,4 +3,3 @@
+ c
+ d
+ e
+-f
+`,
+		},
+		{
+			"from nothing",
+			"",
+			"a b",
+			`--- expected
++++ actual
+@@ -0,0 +1,2 @@
++a
++b
+`,
+		},
+	}
+
+	for _, test := range table {
+		got := unifiedDiff("expected", "actual", strings.Fields(test.from), strings.Fields(test.to))
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("%s: mismatch (-want +got):\n%s", test.name, diff)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/danwhitford/toyrobot/toyrobot"
+)
+
+// runFmt formats .bot files in place, or stdin to stdout if no files are
+// given.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	list := flags.Bool("l", false, "list files whose formatting differs instead of rewriting them")
+	diff := flags.Bool("d", false, "print diffs instead of rewriting files")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		formatted, err := toyrobot.Format(string(content))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "<stdin>:%s\n", err)
+			return 1
+		}
+		fmt.Print(formatted)
+		return 0
+	}
+
+	files, err := botFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	status := 0
+	for _, file := range files {
+		err := formatFile(file, *list, *diff)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", file, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func formatFile(file string, list, diff bool) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	formatted, err := toyrobot.Format(string(content))
+	if err != nil {
+		return err
+	}
+	if formatted == string(content) {
+		return nil
+	}
+	if list {
+		fmt.Println(file)
+	}
+	if diff {
+		fmt.Print(unifiedDiff(file, file+" (formatted)", lines(string(content)), lines(formatted)))
+	}
+	if list || diff {
+		return nil
+	}
+	return os.WriteFile(file, []byte(formatted), 0644)
+}
+
+func lines(s string) []string {
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,48 @@
+// Package wire reads and writes JSON messages framed with a Content-Length
+// header, as used by the Language Server and Debug Adapter protocols.
+package wire
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+)
+
+// MaxMessageSize is the largest message body Read will accept, so that a
+// peer can't make it allocate without limit.
+const MaxMessageSize = 64 << 20
+
+// Read reads the body of the next message.
+func Read(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	value := header.Get("Content-Length")
+	if value == "" {
+		return nil, fmt.Errorf("missing Content-Length")
+	}
+	length, err := strconv.Atoi(value)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("bad Content-Length %q", value)
+	}
+	if length > MaxMessageSize {
+		return nil, fmt.Errorf("Content-Length %d is over the limit of %d", length, MaxMessageSize)
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	return body, err
+}
+
+// Write writes v as JSON with a Content-Length header.
+func Write(w io.Writer, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
@@ -0,0 +1,40 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, map[string]int{"id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := Read(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"id":1}` {
+		t.Errorf("Read got %q", body)
+	}
+}
+
+func TestReadBadHeaders(t *testing.T) {
+	table := []struct {
+		input, want string
+	}{
+		{"Content-Length: -1\r\n\r\n", `bad Content-Length "-1"`},
+		{"Content-Length: ten\r\n\r\n", `bad Content-Length "ten"`},
+		{"Content-Length: 1000000000\r\n\r\n", "Content-Length 1000000000 is over the limit of 67108864"},
+		{"Content-Type: application/json\r\n\r\n{}", "missing Content-Length"},
+	}
+	for _, tst := range table {
+		_, err := Read(bufio.NewReader(strings.NewReader(tst.input)))
+		if err == nil || err.Error() != tst.want {
+			t.Errorf("Read(%q) got error %v, want %s", tst.input, err, tst.want)
+		}
+	}
+}
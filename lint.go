@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/danwhitford/toyrobot/toyrobot"
+)
+
+// runLint checks every .bot file under the paths given, printing what it
+// finds as file:line:col: rule: message.
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	flags.Parse(args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := botFiles(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	status := 0
+	r := toyrobot.NewRobot()
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		program, _, _ := toyrobot.SplitGolden(string(content))
+		for _, finding := range r.Lint(program) {
+			fmt.Printf("%s:%s\n", file, finding)
+			status = 1
+		}
+	}
+	return status
+}
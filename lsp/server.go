@@ -0,0 +1,330 @@
+// Package lsp is a language server for .bot files, speaking the Language
+// Server Protocol over a pair of streams.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/danwhitford/toyrobot/toyrobot"
+)
+
+// Server answers requests about the documents an editor has open.
+type Server struct {
+	in    *bufio.Reader
+	out   io.Writer
+	robot *toyrobot.Robot
+	docs  map[string]*document
+
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:    bufio.NewReader(in),
+		out:   out,
+		robot: toyrobot.NewRobot(),
+		docs:  make(map[string]*document),
+	}
+}
+
+// Serve handles messages until the client sends exit or closes the input.
+func (s *Server) Serve() error {
+	for {
+		msg, err := readMessage(s.in)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				s.replyError(nil, codeParseError, err.Error())
+				continue
+			}
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		}
+		err = s.handle(msg)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg message) error {
+	var result any
+	var err error
+	switch msg.Method {
+	case "initialize":
+		result = map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":           1, // the whole document is sent on every change
+				"hoverProvider":              true,
+				"completionProvider":         map[string]any{},
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]any{"name": "toyrobot"},
+		}
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		err = json.Unmarshal(msg.Params, &params)
+		if err == nil {
+			return s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		err = json.Unmarshal(msg.Params, &params)
+		if err == nil && len(params.ContentChanges) > 0 {
+			return s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		err = json.Unmarshal(msg.Params, &params)
+		if err == nil {
+			delete(s.docs, params.TextDocument.URI)
+			return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		}
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		err = json.Unmarshal(msg.Params, &params)
+		if err == nil {
+			result = s.hover(params)
+		}
+	case "textDocument/completion":
+		result = s.completion()
+	case "textDocument/formatting":
+		var params DocumentFormattingParams
+		err = json.Unmarshal(msg.Params, &params)
+		if err == nil {
+			result = s.format(params)
+		}
+	default:
+		if msg.ID != nil {
+			return s.replyError(msg.ID, codeMethodNotFound, fmt.Sprintf("method not found: %s", msg.Method))
+		}
+		return nil
+	}
+
+	if msg.ID == nil {
+		return nil
+	}
+	if err != nil {
+		return s.replyError(msg.ID, codeInvalidParams, err.Error())
+	}
+	return writeMessage(s.out, response{JSONRPC: "2.0", ID: msg.ID, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, text string) error {
+	return writeMessage(s.out, errorResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   responseError{Code: code, Message: text},
+	})
+}
+
+func (s *Server) notify(method string, params any) error {
+	return writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// update stores a new version of a document and publishes its diagnostics.
+func (s *Server) update(uri, text string) error {
+	doc := newDocument(text)
+	s.docs[uri] = doc
+
+	diagnostics := make([]Diagnostic, 0)
+	parsed := true
+	for _, finding := range s.robot.Lint(doc.program) {
+		severity := SeverityWarning
+		if finding.Rule == toyrobot.RULE_SYNTAX || finding.Rule == toyrobot.RULE_UNKNOWN_WORD {
+			severity = SeverityError
+		}
+		if finding.Rule == toyrobot.RULE_SYNTAX {
+			parsed = false
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    doc.wordRange(finding.Pos),
+			Severity: severity,
+			Code:     finding.Rule,
+			Source:   "toyrobot",
+			Message:  finding.Message,
+		})
+	}
+	// Lint stops at parsing, so limits only the compiler knows about, like
+	// the length of a quotation, are found by compiling
+	if parsed {
+		_, err := (&toyrobot.RobotCompiler{}).Compile(doc.tokens)
+		var compileErr *toyrobot.CompileError
+		if errors.As(err, &compileErr) {
+			diagnostics = append(diagnostics, Diagnostic{
+				Range:    doc.wordRange(compileErr.Pos),
+				Severity: SeverityError,
+				Code:     "compile",
+				Source:   "toyrobot",
+				Message:  compileErr.Err.Error(),
+			})
+		}
+	}
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) *Hover {
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	token, ok := doc.tokenAt(params.Position)
+	if !ok || token.Type != toyrobot.TOKEN_WORD {
+		return nil
+	}
+	word := token.Value.(string)
+	text, ok := toyrobot.WordDocs[word]
+	if !ok {
+		return nil
+	}
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: fmt.Sprintf("**%s** %s", word, text)},
+		Range:    doc.tokenRange(token),
+	}
+}
+
+// completion offers every word the robot knows and the words the compiler
+// handles itself.
+func (s *Server) completion() []CompletionItem {
+	words := make(map[string]bool)
+	for word := range s.robot.Dictionary {
+		words[word] = true
+	}
+	for word := range toyrobot.WordDocs {
+		words[word] = true
+	}
+
+	items := make([]CompletionItem, 0, len(words))
+	for word := range words {
+		kind := KindFunction
+		if _, ok := s.robot.Dictionary[word]; !ok {
+			kind = KindKeyword
+		}
+		items = append(items, CompletionItem{Label: word, Kind: kind, Detail: toyrobot.WordDocs[word]})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Label < items[j].Label
+	})
+	return items
+}
+
+// format replaces the whole document with its formatted version, or
+// returns nil if it can't be formatted.
+func (s *Server) format(params DocumentFormattingParams) []TextEdit {
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	formatted, err := toyrobot.Format(doc.text)
+	if err != nil || formatted == doc.text {
+		return nil
+	}
+	last := len(doc.lines) - 1
+	return []TextEdit{{
+		Range: Range{
+			End: Position{Line: last, Character: utf16Len(doc.lines[last])},
+		},
+		NewText: formatted,
+	}}
+}
+
+// document is an open .bot file.
+type document struct {
+	text    string
+	program string
+	lines   []string
+	tokens  []toyrobot.Token
+}
+
+func newDocument(text string) *document {
+	program, _, _ := toyrobot.SplitGolden(text)
+	doc := &document{
+		text:    text,
+		program: program,
+		lines:   strings.Split(text, "\n"),
+	}
+	// Tokens are only needed for hover, so a document that doesn't
+	// tokenise just has none.
+	doc.tokens, _ = (&toyrobot.RobotTokeniser{}).Tokenise(program)
+	return doc
+}
+
+// tokenAt finds the token under an editor position.
+func (d *document) tokenAt(pos Position) (toyrobot.Token, bool) {
+	p := d.fromLSP(pos)
+	for _, token := range d.tokens {
+		if token.Pos.Line == p.Line && token.Pos.Col <= p.Col && p.Col < token.Pos.Col+len([]rune(token.Lexeme)) {
+			return token, true
+		}
+	}
+	return toyrobot.Token{}, false
+}
+
+func (d *document) tokenRange(token toyrobot.Token) Range {
+	end := token.Pos
+	end.Col += len([]rune(token.Lexeme))
+	return Range{Start: d.toLSP(token.Pos), End: d.toLSP(end)}
+}
+
+// wordRange is the range from pos up to the next space.
+func (d *document) wordRange(pos toyrobot.Position) Range {
+	end := pos
+	if pos.Line-1 < len(d.lines) {
+		line := []rune(d.lines[pos.Line-1])
+		for end.Col-1 < len(line) && line[end.Col-1] != ' ' && line[end.Col-1] != '\t' {
+			end.Col++
+		}
+	}
+	return Range{Start: d.toLSP(pos), End: d.toLSP(end)}
+}
+
+// toLSP converts a 1-based line and column in runes to a 0-based line and
+// offset in UTF-16 code units.
+func (d *document) toLSP(pos toyrobot.Position) Position {
+	if pos.Line < 1 || pos.Line > len(d.lines) {
+		return Position{Line: pos.Line - 1, Character: pos.Col - 1}
+	}
+	line := []rune(d.lines[pos.Line-1])
+	col := pos.Col - 1
+	if col > len(line) {
+		col = len(line)
+	}
+	return Position{Line: pos.Line - 1, Character: utf16Len(string(line[:col]))}
+}
+
+func (d *document) fromLSP(pos Position) toyrobot.Position {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return toyrobot.Position{Line: pos.Line + 1, Col: pos.Character + 1}
+	}
+	units := 0
+	col := 1
+	for _, r := range d.lines[pos.Line] {
+		units += len(utf16.Encode([]rune{r}))
+		if units > pos.Character {
+			break
+		}
+		col++
+	}
+	return toyrobot.Position{Line: pos.Line + 1, Col: col}
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
@@ -0,0 +1,179 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/danwhitford/toyrobot/internal/wire"
+	"github.com/google/go-cmp/cmp"
+)
+
+// runServer sends messages to a new server and returns everything it sends
+// back.
+func runServer(t *testing.T, messages ...string) []map[string]any {
+	t.Helper()
+	var in bytes.Buffer
+	for _, m := range messages {
+		err := writeMessage(&in, json.RawMessage(m))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	err := NewServer(&in, &out).Serve()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []map[string]any
+	r := bufio.NewReader(&out)
+	for {
+		body, err := wire.Read(r)
+		if err != nil {
+			break
+		}
+		var msg map[string]any
+		err = json.Unmarshal(body, &msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, msg)
+	}
+	return got
+}
+
+func TestServer(t *testing.T) {
+	got := runServer(t,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.bot","text":"move   FROB\n1 IF"}}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":"file:///a.bot"},"contentChanges":[{"text":"\"é\" move   FROB\n"}]}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"textDocument/hover","params":{"textDocument":{"uri":"file:///a.bot"},"position":{"line":0,"character":5}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"textDocument/hover","params":{"textDocument":{"uri":"file:///a.bot"},"position":{"line":0,"character":1}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"textDocument/formatting","params":{"textDocument":{"uri":"file:///a.bot"},"options":{}}}`,
+		// Words can't be defined yet, so there's no definition to go to
+		`{"jsonrpc":"2.0","id":5,"method":"textDocument/definition","params":{"textDocument":{"uri":"file:///a.bot"},"position":{"line":0,"character":5}}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"nonsense"}`,
+		`{"jsonrpc":"2.0","id":7,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+
+	if len(got) != 9 {
+		t.Fatalf("got %d messages, want 9: %v", len(got), got)
+	}
+	if got[0]["id"] != 1.0 {
+		t.Errorf("first reply should be to initialize, got %v", got[0])
+	}
+	capabilities := got[0]["result"].(map[string]any)["capabilities"].(map[string]any)
+	if _, ok := capabilities["definitionProvider"]; ok {
+		t.Errorf("definitions shouldn't be offered: %v", capabilities)
+	}
+
+	params := func(i int) any { return got[i]["params"] }
+	wantOpen := map[string]any{
+		"uri": "file:///a.bot",
+		"diagnostics": []any{
+			diagnostic(1, 2, 1, 4, 1, "syntax", "IF without THEN"),
+		},
+	}
+	if diff := cmp.Diff(wantOpen, params(1)); diff != "" {
+		t.Errorf("diagnostics on open mismatch (-want +got):\n%s", diff)
+	}
+	wantChange := map[string]any{
+		"uri": "file:///a.bot",
+		"diagnostics": []any{
+			diagnostic(0, 4, 0, 8, 2, "move-before-place", "MOVE before PLACE does nothing"),
+			diagnostic(0, 11, 0, 15, 1, "unknown-word", "unknown word 'FROB'"),
+		},
+	}
+	if diff := cmp.Diff(wantChange, params(2)); diff != "" {
+		t.Errorf("diagnostics on change mismatch (-want +got):\n%s", diff)
+	}
+
+	wantHover := map[string]any{
+		"contents": map[string]any{"kind": "markdown", "value": "**MOVE** ( -- ) Move the robot one square forward unless it would fall off the board."},
+		"range": map[string]any{
+			"start": map[string]any{"line": 0.0, "character": 4.0},
+			"end":   map[string]any{"line": 0.0, "character": 8.0},
+		},
+	}
+	if diff := cmp.Diff(wantHover, got[3]["result"]); diff != "" {
+		t.Errorf("hover mismatch (-want +got):\n%s", diff)
+	}
+	if got[4]["result"] != nil {
+		t.Errorf("hover over a string should be null, got %v", got[4]["result"])
+	}
+	wantFormat := []any{
+		map[string]any{
+			"range": map[string]any{
+				"start": map[string]any{"line": 0.0, "character": 0.0},
+				"end":   map[string]any{"line": 1.0, "character": 0.0},
+			},
+			"newText": "\"é\" MOVE FROB\n",
+		},
+	}
+	if diff := cmp.Diff(wantFormat, got[5]["result"]); diff != "" {
+		t.Errorf("formatting mismatch (-want +got):\n%s", diff)
+	}
+	for _, msg := range got[6:8] {
+		if code := msg["error"].(map[string]any)["code"]; code != float64(codeMethodNotFound) {
+			t.Errorf("unsupported method %v gave error code %v", msg["id"], code)
+		}
+	}
+	if _, ok := got[8]["result"]; !ok || got[8]["id"] != 7.0 {
+		t.Errorf("bad reply to shutdown %v", got[8])
+	}
+}
+
+func TestCompileDiagnostics(t *testing.T) {
+	program := "0 0 NORTH PLACE\n{ " + strings.Repeat("1 DROP ", 20000) + "}\n"
+	open, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "textDocument/didOpen",
+		"params":  map[string]any{"textDocument": map[string]any{"uri": "file:///a.bot", "text": program}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := runServer(t, string(open))
+	want := map[string]any{
+		"uri": "file:///a.bot",
+		"diagnostics": []any{
+			diagnostic(1, 0, 1, 1, 1, "compile", "quotation too long"),
+		},
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d messages, want 1", len(got))
+	}
+	if diff := cmp.Diff(want, got[0]["params"]); diff != "" {
+		t.Errorf("diagnostics mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	items := NewServer(nil, nil).completion()
+	kinds := make(map[string]int)
+	for _, item := range items {
+		kinds[item.Label] = item.Kind
+	}
+	if kinds["MOVE"] != KindFunction || kinds["THEN"] != KindKeyword {
+		t.Errorf("MOVE should be a function and THEN a keyword, got %d and %d", kinds["MOVE"], kinds["THEN"])
+	}
+}
+
+func diagnostic(l1, c1, l2, c2, severity int, code, message string) map[string]any {
+	return map[string]any{
+		"range": map[string]any{
+			"start": map[string]any{"line": float64(l1), "character": float64(c1)},
+			"end":   map[string]any{"line": float64(l2), "character": float64(c2)},
+		},
+		"severity": float64(severity),
+		"code":     code,
+		"source":   "toyrobot",
+		"message":  message,
+	}
+}
@@ -2,15 +2,158 @@ package main
 
 import (
 	"bufio"
+	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
 
+	"github.com/danwhitford/toyrobot/dap"
+	"github.com/danwhitford/toyrobot/lsp"
 	"github.com/danwhitford/toyrobot/toyrobot"
 )
 
+var trace = flag.String("trace", "", "log every instruction to stderr as `text` or json")
+var optimise = flag.Bool("O", false, "optimise programs before running them")
+var replay = flag.String("gif", "", "write an animated replay of the robot's moves to `file`")
+var format = flag.String("format", "text", "print REPORT as X,Y,F `text` or as json with the whole of the robot's state")
+var board = flag.String("board", "ascii", "draw BOARD as `ascii` or unicode, which falls back to ascii when stdout isn't a terminal")
+
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: toyrobot [flags] [file.bot]")
+		fmt.Fprintln(os.Stderr, "       toyrobot test [-update] [dir]")
+		fmt.Fprintln(os.Stderr, "       toyrobot debug file.bot")
+		fmt.Fprintln(os.Stderr, "       toyrobot fmt [-l] [-d] [path ...]")
+		fmt.Fprintln(os.Stderr, "       toyrobot lint [path ...]")
+		fmt.Fprintln(os.Stderr, "       toyrobot tui")
+		fmt.Fprintln(os.Stderr, "       toyrobot lsp")
+		fmt.Fprintln(os.Stderr, "       toyrobot dap")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "test":
+		os.Exit(runTests(flag.Args()[1:], os.Stdout))
+	case "debug":
+		os.Exit(runDebug(flag.Args()[1:]))
+	case "fmt":
+		os.Exit(runFmt(flag.Args()[1:]))
+	case "lint":
+		os.Exit(runLint(flag.Args()[1:]))
+	case "lsp":
+		os.Exit(serve(lsp.NewServer(os.Stdin, os.Stdout)))
+	case "dap":
+		os.Exit(serve(dap.NewServer(os.Stdin, os.Stdout)))
+	}
+
 	r := toyrobot.NewRobot()
+	r.Optimise = *optimise
+	r.CreateFile = createFile
+	style, err := toyrobot.ParseBoardStyle(*board)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	r.BoardStyle = style
+	switch *format {
+	case "text":
+	case "json":
+		r.ReportFormat = toyrobot.REPORT_JSON
+	default:
+		fmt.Fprintf(os.Stderr, "unknown report format %q\n", *format)
+		os.Exit(2)
+	}
+	switch *trace {
+	case "":
+	case "text":
+		r.Trace = os.Stderr
+	case "json":
+		r.Trace = os.Stderr
+		r.TraceFormat = toyrobot.TRACE_JSON
+	default:
+		fmt.Fprintf(os.Stderr, "unknown trace format %q\n", *trace)
+		os.Exit(2)
+	}
+
+	r.Record = *replay != ""
+
+	if flag.Arg(0) == "tui" {
+		// Each line is a program of its own, so there'd be nothing to replay,
+		// and a trace would be drawn over the screen
+		if r.Record || r.Trace != nil {
+			fmt.Fprintln(os.Stderr, "-gif and -trace can't be used with tui")
+			os.Exit(2)
+		}
+		os.Exit(runTUI(r, flag.Args()[1:]))
+	}
+
+	if flag.NArg() == 0 {
+		if r.Record {
+			// Each line is a program of its own, so there'd be nothing to replay
+			fmt.Fprintln(os.Stderr, "-gif needs a file to run")
+			os.Exit(2)
+		}
+		repl(r)
+		return
+	}
+	code := runFile(r, flag.Arg(0))
+	if r.Record {
+		err := saveReplay(r, *replay)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// saveReplay writes the robot's moves so far as an animated GIF.
+func saveReplay(r *toyrobot.Robot, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = toyrobot.RenderGIF(f, r.Frames)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// createFile lets programs run from the command line save files, as they're
+// the user's own.
+func createFile(path string) (io.WriteCloser, error) {
+	return os.Create(path)
+}
+
+func serve(server interface{ Serve() error }) int {
+	err := server.Serve()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runFile(r *toyrobot.Robot, file string) int {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	program, _, _ := toyrobot.SplitGolden(string(content))
+	err = r.RunProgram(program)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func repl(r *toyrobot.Robot) {
 	buf := bufio.NewReader(os.Stdin)
 	for {
 		line, _, err := buf.ReadLine()
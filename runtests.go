@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danwhitford/toyrobot/toyrobot"
+)
+
+// runTests runs every .bot file under a directory and compares what it
+// prints with its ### OUTPUT ### block, reporting the results to out.
+func runTests(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	update := flags.Bool("update", false, "rewrite the expected output of each file with its actual output")
+	flags.Parse(args)
+
+	dir := "."
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
+
+	files, err := botFiles([]string{dir})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	passed, failed := 0, 0
+	for _, file := range files {
+		ok, err := runTest(out, file, *update)
+		switch {
+		case err != nil:
+			fmt.Fprintf(out, "FAIL %s\n    %s\n", file, err)
+			failed++
+		case ok:
+			fmt.Fprintf(out, "PASS %s\n", file)
+			passed++
+		default:
+			failed++
+		}
+	}
+
+	fmt.Fprintf(out, "%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// botFiles returns the paths given that are files along with every .bot file
+// under the paths that are directories.
+func botFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && (path == root || filepath.Ext(path) == ".bot") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func runTest(out io.Writer, file string, update bool) (bool, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+	got, want, hasGolden, err := toyrobot.RunGolden(string(content))
+	if err != nil {
+		return false, err
+	}
+
+	diff := unifiedDiff("expected", "actual", toyrobot.GoldenLines(want), toyrobot.GoldenLines(got))
+	if update {
+		if !hasGolden || diff != "" {
+			fmt.Fprintf(out, "UPDATE %s\n", file)
+			return true, os.WriteFile(file, []byte(toyrobot.UpdateGolden(string(content), got)), 0644)
+		}
+		return true, nil
+	}
+	if !hasGolden {
+		return false, fmt.Errorf("no %s block", strings.TrimSpace(toyrobot.GoldenMarker))
+	}
+	if diff != "" {
+		fmt.Fprintf(out, "FAIL %s\n%s", file, diff)
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeTests writes a passing, a failing and an unchecked .bot file to a new
+// directory.
+func writeTests(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"fail.bot": "1 . 2 .\n### OUTPUT ###\n# 1\n# 3\n",
+		"none.bot": "4 .\n",
+		"pass.bot": "1 .\n### OUTPUT ###\n# 1\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRunTests(t *testing.T) {
+	dir := writeTests(t)
+	var out bytes.Buffer
+	code := runTests([]string{dir}, &out)
+	if code != 1 {
+		t.Errorf("exit status %d, want 1", code)
+	}
+	want := `FAIL DIR/fail.bot
+--- expected
++++ actual
+@@ -1,2 +1,2 @@
+ 1
+-3
++2
+FAIL DIR/none.bot
+    no ### OUTPUT ### block
+PASS DIR/pass.bot
+1 passed, 2 failed
+`
+	if diff := cmp.Diff(want, strings.ReplaceAll(out.String(), dir, "DIR")); diff != "" {
+		t.Errorf("output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunTestsUpdate(t *testing.T) {
+	dir := writeTests(t)
+	var out bytes.Buffer
+	code := runTests([]string{"-update", dir}, &out)
+	if code != 0 {
+		t.Errorf("exit status %d, want 0", code)
+	}
+	want := `UPDATE DIR/fail.bot
+PASS DIR/fail.bot
+UPDATE DIR/none.bot
+PASS DIR/none.bot
+PASS DIR/pass.bot
+3 passed, 0 failed
+`
+	if diff := cmp.Diff(want, strings.ReplaceAll(out.String(), dir, "DIR")); diff != "" {
+		t.Errorf("output mismatch (-want +got):\n%s", diff)
+	}
+
+	for name, want := range map[string]string{
+		"fail.bot": "1 . 2 .\n### OUTPUT ###\n# 1\n# 2\n",
+		"none.bot": "4 .\n### OUTPUT ###\n# 4\n",
+		"pass.bot": "1 .\n### OUTPUT ###\n# 1\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, string(got)); diff != "" {
+			t.Errorf("%s mismatch (-want +got):\n%s", name, diff)
+		}
+	}
+
+	// Everything passes once updated
+	out.Reset()
+	if code := runTests([]string{dir}, &out); code != 0 {
+		t.Errorf("exit status %d after -update, want 0:\n%s", code, out.String())
+	}
+}
@@ -1,6 +1,9 @@
 package stack
 
-import "fmt"
+import "errors"
+
+// ErrUnderflow is returned when popping from an empty stack.
+var ErrUnderflow = errors.New("stack is empty")
 
 type RobotStack[T any] []T
 
@@ -11,7 +14,7 @@ func (s *RobotStack[T]) Push(v T) {
 func (s *RobotStack[T]) Pop() (T, error) {
 	if len(*s) == 0 {
 		var t T
-		return t, fmt.Errorf("stack is empty")
+		return t, ErrUnderflow
 	}
 	v := (*s)[len(*s)-1]
 	*s = (*s)[:len(*s)-1]
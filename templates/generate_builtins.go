@@ -3,13 +3,12 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 	"text/template"
 )
 
 const robotTemplate = `package toyrobot
-
-import "fmt"
-{{ range . }}
+{{ range .Binary }}
 func (r *Robot) {{ .FunctionName }}() error {
 	a, err := r.RobotValueStack.Pop()
 	if err != nil {
@@ -20,35 +19,134 @@ func (r *Robot) {{ .FunctionName }}() error {
 		return err
 	}
 	if a.Type != b.Type {
-		return fmt.Errorf("types do not match")
+		return &TypeMismatchError{Word: {{ printf "%q" .Word }}, Expected: []RobotType{b.Type}, Actual: a.Type}
+	}
+	switch a.Type {
+	{{- $word := .Word }}
+	{{- range .Cases }}
+	case {{ .ArgType }}:
+		{{- if .Divides }}
+		if a.Value.({{ .GoType }}) == 0 {
+			return &DivisionByZeroError{Word: {{ printf "%q" $word }}}
+		}
+		{{- end }}
+		{{- if .Grows }}
+		v := RobotValue{Type: {{ .ResType }}, Value: b.Value.({{ .GoType }}) {{ .FunctionOp }} a.Value.({{ .GoType }})}
+		err := r.checkSize(v)
+		if err != nil {
+			return err
+		}
+		r.RobotValueStack.Push(v)
+		{{- else }}
+		r.RobotValueStack.Push(RobotValue{Type: {{ .ResType }}, Value: b.Value.({{ .GoType }}) {{ .FunctionOp }} a.Value.({{ .GoType }})})
+		{{- end }}
+	{{- end }}
+	default:
+		return &TypeMismatchError{Word: {{ printf "%q" .Word }}, Expected: []RobotType{ {{- .ArgTypes -}} }, Actual: a.Type}
+	}
+	return nil
+}
+{{ end }}
+{{- range .Unary }}
+func (r *Robot) {{ .FunctionName }}() error {
+	a, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
 	}
 	switch a.Type {
-	case T_INT:
-		r.RobotValueStack.Push(RobotValue{Type: {{ .ResType }}, Value: b.Value.(int) {{ .FunctionOp }} a.Value.(int)})
+	{{- range .Cases }}
+	case {{ .ArgType }}:
+		r.RobotValueStack.Push(RobotValue{Type: {{ .ResType }}, Value: {{ .FunctionOp }}a.Value.({{ .GoType }})})
+	{{- end }}
 	default:
-		return fmt.Errorf("unsupported type")
+		return &TypeMismatchError{Word: {{ printf "%q" .Word }}, Expected: []RobotType{ {{- .ArgTypes -}} }, Actual: a.Type}
 	}
 	return nil
 }
 {{ end }}`
 
+type opCase struct {
+	ArgType    string
+	GoType     string
+	FunctionOp string
+	ResType    string
+}
+
+// Divides reports whether the case fails on a right hand side of zero.
+func (c opCase) Divides() bool {
+	return c.FunctionOp == "/" || c.FunctionOp == "%"
+}
+
+// Grows reports whether the case makes a value that can be bigger than
+// either argument, so has to be checked against Robot.MaxValueSize.
+func (c opCase) Grows() bool {
+	return c.ResType == "T_STRING"
+}
+
+type op struct {
+	FunctionName string
+	Word         string
+	Cases        []opCase
+}
+
+// ArgTypes lists the types the op accepts, for use in error messages.
+func (o op) ArgTypes() string {
+	types := make([]string, len(o.Cases))
+	for i, c := range o.Cases {
+		types[i] = c.ArgType
+	}
+	return strings.Join(types, ", ")
+}
+
+func intOp(name, word, fop, resType string) op {
+	return op{name, word, []opCase{{"T_INT", "int", fop, resType}}}
+}
+
 func main() {
-	datas := []struct {
-		FunctionName string
-		FunctionOp   string
-		ResType      string
+	datas := struct {
+		Binary []op
+		Unary  []op
 	}{
-		{"mul", "*", "T_INT"},
-		{"add", "+", "T_INT"},
-		{"sub", "-", "T_INT"},
-		{"div", "/", "T_INT"},
-		{"mod", "%", "T_INT"},
-		{"eq", "==", "T_BOOL"},
-		{"neq", "!=", "T_BOOL"},
-		{"lt", "<", "T_BOOL"},
-		{"gt", ">", "T_BOOL"},
-		{"lte", "<=", "T_BOOL"},
-		{"gte", ">=", "T_BOOL"},
+		Binary: []op{
+			intOp("mul", "*", "*", "T_INT"),
+			{"add", "+", []opCase{
+				{"T_INT", "int", "+", "T_INT"},
+				{"T_STRING", "string", "+", "T_STRING"},
+			}},
+			intOp("sub", "-", "-", "T_INT"),
+			intOp("div", "/", "/", "T_INT"),
+			intOp("mod", "MOD", "%", "T_INT"),
+			{"eq", "=", []opCase{
+				{"T_INT", "int", "==", "T_BOOL"},
+				{"T_STRING", "string", "==", "T_BOOL"},
+			}},
+			{"neq", "<>", []opCase{
+				{"T_INT", "int", "!=", "T_BOOL"},
+				{"T_STRING", "string", "!=", "T_BOOL"},
+			}},
+			intOp("lt", "<", "<", "T_BOOL"),
+			intOp("gt", ">", ">", "T_BOOL"),
+			intOp("lte", "<=", "<=", "T_BOOL"),
+			intOp("gte", ">=", ">=", "T_BOOL"),
+			{"and", "AND", []opCase{
+				{"T_BOOL", "bool", "&&", "T_BOOL"},
+				{"T_INT", "int", "&", "T_INT"},
+			}},
+			{"or", "OR", []opCase{
+				{"T_BOOL", "bool", "||", "T_BOOL"},
+				{"T_INT", "int", "|", "T_INT"},
+			}},
+			{"xor", "XOR", []opCase{
+				{"T_BOOL", "bool", "!=", "T_BOOL"},
+				{"T_INT", "int", "^", "T_INT"},
+			}},
+		},
+		Unary: []op{
+			{"not", "NOT", []opCase{
+				{"T_BOOL", "bool", "!", "T_BOOL"},
+				{"T_INT", "int", "^", "T_INT"},
+			}},
+		},
 	}
 
 	tmpl, err := template.New("robotMul").Parse(robotTemplate)
@@ -0,0 +1,192 @@
+package toyrobot
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Point is a square on the board.
+type Point struct {
+	X, Y int
+}
+
+// Edge is a move between two neighbouring squares, whichever way it went.
+// A is the square nearer the bottom left.
+type Edge struct {
+	A, B Point
+}
+
+func newEdge(from, to Point) Edge {
+	if to.X < from.X || to.Y < from.Y {
+		from, to = to, from
+	}
+	return Edge{from, to}
+}
+
+// Trail is where the robot has been since it was placed: the squares it has
+// been on and the moves it has made between them, each in the order first
+// reached. Going over the same ground again adds nothing, so a long run
+// keeps no more than the board has room for.
+type Trail struct {
+	Squares []Point
+	Edges   []Edge
+}
+
+func newTrail(p Point) Trail {
+	return Trail{Squares: []Point{p}}
+}
+
+// Visited reports whether the robot has been on p.
+func (t Trail) Visited(p Point) bool {
+	for _, s := range t.Squares {
+		if s == p {
+			return true
+		}
+	}
+	return false
+}
+
+// add records a move from one square to another.
+func (t *Trail) add(from, to Point) {
+	if from == to {
+		return
+	}
+	if !t.Visited(to) {
+		t.Squares = append(t.Squares, to)
+	}
+	e := newEdge(from, to)
+	for _, seen := range t.Edges {
+		if seen == e {
+			return
+		}
+	}
+	t.Edges = append(t.Edges, e)
+}
+
+// BoardStyle is how BOARD draws the board.
+type BoardStyle byte
+
+const (
+	// Plain ASCII, which works anywhere
+	BOARD_ASCII BoardStyle = iota
+	// Box drawing characters, arrows and colour. Drawn as ASCII when the
+	// output isn't a terminal.
+	BOARD_UNICODE
+)
+
+var boardStyles = map[string]BoardStyle{
+	"ascii":   BOARD_ASCII,
+	"unicode": BOARD_UNICODE,
+}
+
+// ParseBoardStyle returns the board style with the given name.
+func ParseBoardStyle(name string) (BoardStyle, error) {
+	style, ok := boardStyles[strings.ToLower(name)]
+	if !ok {
+		return BOARD_ASCII, fmt.Errorf("unknown board style '%s', expecting ascii or unicode", name)
+	}
+	return style, nil
+}
+
+// ANSI escapes for the unicode board
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRobot  = "\x1b[1;33m"
+	ansiTrail  = "\x1b[36m"
+	ansiBorder = "\x1b[2m"
+)
+
+func (r *Robot) printBoard() error {
+	if r.BoardStyle == BOARD_UNICODE && isTerminal(r.Output) {
+		fmt.Fprint(r.Output, r.RenderBoard(BOARD_UNICODE, os.Getenv("NO_COLOR") == ""))
+		return nil
+	}
+	fmt.Fprint(r.Output, r.RenderBoard(BOARD_ASCII, false))
+	return nil
+}
+
+// ( style -- )
+func (r *Robot) setBoardStyle() error {
+	v, err := r.popType(T_STRING, "BOARD-STYLE")
+	if err != nil {
+		return err
+	}
+	style, err := ParseBoardStyle(v.Value.(string))
+	if err != nil {
+		return err
+	}
+	r.BoardStyle = style
+	return nil
+}
+
+// RenderBoard draws the board with the robot on it. The unicode style
+// shows the robot's trail too, in colour if colour is set.
+func (r *Robot) RenderBoard(style BoardStyle, colour bool) string {
+	if style == BOARD_UNICODE {
+		return r.renderUnicode(colour)
+	}
+
+	var sb strings.Builder
+	hr := "+" + strings.Repeat("---+", BoardSize) + "\n"
+	for y := BoardSize - 1; y >= 0; y-- {
+		sb.WriteString(hr)
+		for x := 0; x < BoardSize; x++ {
+			cell := " "
+			if r.Placed && r.X == x && r.Y == y {
+				cell = asciiArrows[r.F]
+			}
+			fmt.Fprintf(&sb, "| %s ", cell)
+		}
+		sb.WriteString("|\n")
+	}
+	sb.WriteString(hr)
+	return sb.String()
+}
+
+var asciiArrows = map[Direction]string{NORTH: "^", EAST: ">", SOUTH: "v", WEST: "<"}
+var unicodeArrows = map[Direction]string{NORTH: "↑", EAST: "→", SOUTH: "↓", WEST: "←"}
+
+func (r *Robot) renderUnicode(colour bool) string {
+	paint := func(code, s string) string {
+		if !colour {
+			return s
+		}
+		return code + s + ansiReset
+	}
+	rule := func(left, mid, right string) string {
+		return paint(ansiBorder, left+strings.Repeat("───"+mid, BoardSize-1)+"───"+right) + "\n"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(rule("┌", "┬", "┐"))
+	for y := BoardSize - 1; y >= 0; y-- {
+		for x := 0; x < BoardSize; x++ {
+			cell := " "
+			switch {
+			case r.Placed && r.X == x && r.Y == y:
+				cell = paint(ansiRobot, unicodeArrows[r.F])
+			case r.Placed && r.Trail.Visited(Point{x, y}):
+				cell = paint(ansiTrail, "·")
+			}
+			fmt.Fprintf(&sb, "%s %s ", paint(ansiBorder, "│"), cell)
+		}
+		sb.WriteString(paint(ansiBorder, "│") + "\n")
+		if y > 0 {
+			sb.WriteString(rule("├", "┼", "┤"))
+		}
+	}
+	sb.WriteString(rule("└", "┴", "┘"))
+	return sb.String()
+}
+
+// isTerminal reports whether w is a terminal, so can show unicode and
+// colour.
+func isTerminal(w any) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,192 @@
+package toyrobot
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// Sizes in pixels of the board images
+const (
+	cellSize    = 48
+	boardMargin = 8
+	imageSize   = boardMargin*2 + cellSize*BoardSize
+	trailWidth  = 4
+)
+
+var (
+	colourBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	colourGrid       = color.RGBA{0x99, 0x99, 0x99, 0xff}
+	colourTrail      = color.RGBA{0x4a, 0x90, 0xd9, 0xff}
+	colourRobot      = color.RGBA{0xe8, 0x59, 0x0c, 0xff}
+)
+
+// cellCentre is the centre in pixels of a square, with y going down the
+// image.
+func cellCentre(p Point) (float64, float64) {
+	return float64(boardMargin + p.X*cellSize + cellSize/2),
+		float64(boardMargin + (BoardSize-1-p.Y)*cellSize + cellSize/2)
+}
+
+// robotTriangle is the corners of the triangle drawn for the robot, which
+// points the way it is facing.
+func (f Frame) robotTriangle() [3][2]float64 {
+	cx, cy := cellCentre(Point{f.X, f.Y})
+	dx, dy := 0.0, 0.0
+	switch f.F {
+	case NORTH:
+		dy = -1
+	case EAST:
+		dx = 1
+	case SOUTH:
+		dy = 1
+	case WEST:
+		dx = -1
+	}
+	tip, back, side := cellSize*0.35, cellSize*0.25, cellSize*0.28
+	return [3][2]float64{
+		{cx + dx*tip, cy + dy*tip},
+		{cx - dx*back - dy*side, cy - dy*back + dx*side},
+		{cx - dx*back + dy*side, cy - dy*back - dx*side},
+	}
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// RenderSVG draws the board, the robot's trail and the robot as SVG.
+func (r *Robot) RenderSVG(w io.Writer) error {
+	return r.Frame().RenderSVG(w)
+}
+
+// RenderSVG draws the board as it was at the frame as SVG.
+func (f Frame) RenderSVG(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", imageSize, imageSize, imageSize, imageSize)
+	fmt.Fprintf(&sb, `<rect width="%d" height="%d" fill="%s"/>`+"\n", imageSize, imageSize, hex(colourBackground))
+	for i := 0; i <= BoardSize; i++ {
+		at := boardMargin + i*cellSize
+		fmt.Fprintf(&sb, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s"/>`+"\n", at, boardMargin, at, imageSize-boardMargin, hex(colourGrid))
+		fmt.Fprintf(&sb, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s"/>`+"\n", boardMargin, at, imageSize-boardMargin, at, hex(colourGrid))
+	}
+	if f.Placed {
+		for _, p := range f.Trail.Squares {
+			x, y := cellCentre(p)
+			fmt.Fprintf(&sb, `<circle cx="%g" cy="%g" r="%d" fill="%s"/>`+"\n", x, y, trailWidth, hex(colourTrail))
+		}
+		for _, e := range f.Trail.Edges {
+			x1, y1 := cellCentre(e.A)
+			x2, y2 := cellCentre(e.B)
+			fmt.Fprintf(&sb, `<line x1="%g" y1="%g" x2="%g" y2="%g" stroke="%s" stroke-width="%d" stroke-linecap="round"/>`+"\n", x1, y1, x2, y2, hex(colourTrail), trailWidth)
+		}
+		corners := f.robotTriangle()
+		fmt.Fprintf(&sb, `<polygon points="%g,%g %g,%g %g,%g" fill="%s"/>`+"\n",
+			corners[0][0], corners[0][1], corners[1][0], corners[1][1], corners[2][0], corners[2][1], hex(colourRobot))
+	}
+	sb.WriteString("</svg>\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// BoardImage draws the board, the robot's trail and the robot.
+func (r *Robot) BoardImage() *image.RGBA {
+	return r.Frame().Image()
+}
+
+// Image draws the board as it was at the frame.
+func (f Frame) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, imageSize, imageSize))
+	fillRect(img, img.Bounds(), colourBackground)
+	for i := 0; i <= BoardSize; i++ {
+		at := boardMargin + i*cellSize
+		fillRect(img, image.Rect(at, boardMargin, at+1, imageSize-boardMargin+1), colourGrid)
+		fillRect(img, image.Rect(boardMargin, at, imageSize-boardMargin+1, at+1), colourGrid)
+	}
+	if !f.Placed {
+		return img
+	}
+
+	for _, p := range f.Trail.Squares {
+		x, y := cellCentre(p)
+		fillRect(img, image.Rect(int(x)-trailWidth, int(y)-trailWidth, int(x)+trailWidth, int(y)+trailWidth), colourTrail)
+	}
+	// Each edge is between neighbouring squares, so its lines are all
+	// horizontal or vertical
+	for _, e := range f.Trail.Edges {
+		x1, y1 := cellCentre(e.A)
+		x2, y2 := cellCentre(e.B)
+		line := image.Rect(int(x1), int(y1), int(x2), int(y2)).Canon()
+		fillRect(img, image.Rect(line.Min.X-trailWidth/2, line.Min.Y-trailWidth/2, line.Max.X+trailWidth/2, line.Max.Y+trailWidth/2), colourTrail)
+	}
+	fillTriangle(img, f.robotTriangle(), colourRobot)
+	return img
+}
+
+// RenderPNG draws the board as a PNG.
+func (r *Robot) RenderPNG(w io.Writer) error {
+	return png.Encode(w, r.BoardImage())
+}
+
+func fillRect(img *image.RGBA, rect image.Rectangle, c color.RGBA) {
+	rect = rect.Intersect(img.Bounds())
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+// fillTriangle colours the pixels whose centres are inside a triangle.
+func fillTriangle(img *image.RGBA, t [3][2]float64, c color.RGBA) {
+	edge := func(a, b [2]float64, x, y float64) float64 {
+		return (b[0]-a[0])*(y-a[1]) - (b[1]-a[1])*(x-a[0])
+	}
+	var bounds image.Rectangle
+	for _, p := range t {
+		bounds = bounds.Union(image.Rect(int(p[0]), int(p[1]), int(p[0])+1, int(p[1])+1))
+	}
+	bounds = bounds.Inset(-1).Intersect(img.Bounds())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			px, py := float64(x)+0.5, float64(y)+0.5
+			e0, e1, e2 := edge(t[0], t[1], px, py), edge(t[1], t[2], px, py), edge(t[2], t[0], px, py)
+			if e0 >= 0 && e1 >= 0 && e2 >= 0 || e0 <= 0 && e1 <= 0 && e2 <= 0 {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+// ( path -- )
+func (r *Robot) saveSVG() error {
+	return r.saveImage("SAVE-SVG", r.RenderSVG)
+}
+
+// ( path -- )
+func (r *Robot) savePNG() error {
+	return r.saveImage("SAVE-PNG", r.RenderPNG)
+}
+
+func (r *Robot) saveImage(word string, render func(io.Writer) error) error {
+	v, err := r.popType(T_STRING, word)
+	if err != nil {
+		return err
+	}
+	if r.CreateFile == nil {
+		return ErrFileOutputDisabled
+	}
+	f, err := r.CreateFile(v.Value.(string))
+	if err != nil {
+		return err
+	}
+	err = render(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
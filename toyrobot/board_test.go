@@ -0,0 +1,164 @@
+package toyrobot
+
+import (
+	"bytes"
+	"errors"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBoardImage(t *testing.T) {
+	robot := NewRobot()
+	robot.Output = io.Discard
+	err := robot.RunProgram("0 0 NORTH PLACE MOVE RIGHT MOVE")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := robot.BoardImage()
+	at := func(p Point) color.RGBA {
+		x, y := cellCentre(p)
+		return img.RGBAAt(int(x), int(y))
+	}
+	table := []struct {
+		p    Point
+		want color.RGBA
+	}{
+		{Point{1, 1}, colourRobot},
+		{Point{0, 0}, colourTrail},
+		{Point{0, 1}, colourTrail},
+		{Point{3, 3}, colourBackground},
+	}
+	for _, tst := range table {
+		if got := at(tst.p); got != tst.want {
+			t.Errorf("colour at %v = %v, want %v", tst.p, got, tst.want)
+		}
+	}
+	if got := img.RGBAAt(boardMargin, boardMargin); got != colourGrid {
+		t.Errorf("colour of the grid's corner = %v, want %v", got, colourGrid)
+	}
+}
+
+func TestSaveImages(t *testing.T) {
+	dir := t.TempDir()
+	svgPath := filepath.Join(dir, "board.svg")
+	pngPath := filepath.Join(dir, "board.png")
+	program := "2 2 EAST PLACE MOVE " + quoteString(svgPath) + " SAVE-SVG " + quoteString(pngPath) + " SAVE-PNG"
+
+	robot := NewRobot()
+	err := robot.RunProgram(program)
+	if !errors.Is(err, ErrFileOutputDisabled) {
+		t.Fatalf("saving without CreateFile should fail, got %v", err)
+	}
+	if _, err := os.Stat(svgPath); !os.IsNotExist(err) {
+		t.Fatalf("SVG was written without CreateFile")
+	}
+
+	robot = NewRobot()
+	robot.CreateFile = func(path string) (io.WriteCloser, error) { return os.Create(path) }
+	err = robot.RunProgram(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svg, err := os.ReadFile(svgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<line x1="128" y1="128" x2="176" y2="128"`,
+		`<polygon points="192.8,128 164,141.44 164,114.56" fill="#e8590c"/>`,
+	} {
+		if !strings.Contains(string(svg), want) {
+			t.Errorf("SVG doesn't contain %s:\n%s", want, svg)
+		}
+	}
+
+	content, err := os.ReadFile(pngPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !img.Bounds().Eq(robot.BoardImage().Bounds()) {
+		t.Errorf("PNG is %v, want %v", img.Bounds(), robot.BoardImage().Bounds())
+	}
+}
+
+func TestReplay(t *testing.T) {
+	robot := NewRobot()
+	robot.Output = io.Discard
+	robot.Record = true
+	// MOVE before PLACE, MOVE off the board and REPORT change nothing, so
+	// don't get frames
+	err := robot.RunProgram("MOVE 0 0 SOUTH PLACE MOVE LEFT MOVE REPORT LEFT REPORT")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := Trail{Squares: []Point{{0, 0}}}
+	moved := Trail{Squares: []Point{{0, 0}, {1, 0}}, Edges: []Edge{{Point{0, 0}, Point{1, 0}}}}
+	want := []Frame{
+		{X: 0, Y: 0, F: SOUTH, Placed: true, Trail: start},
+		{X: 0, Y: 0, F: EAST, Placed: true, Trail: start},
+		{X: 1, Y: 0, F: EAST, Placed: true, Trail: moved},
+		{X: 1, Y: 0, F: NORTH, Placed: true, Trail: moved},
+	}
+	if diff := cmp.Diff(want, robot.Frames); diff != "" {
+		t.Errorf("frames mismatch (-want +got):\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+	err = RenderGIF(&buf, robot.Frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != len(want) {
+		t.Fatalf("GIF has %d frames, want %d", len(anim.Image), len(want))
+	}
+	x, y := cellCentre(Point{1, 0})
+	if got := anim.Image[2].At(int(x), int(y)); got != colourRobot {
+		t.Errorf("robot colour in frame 2 = %v, want %v", got, colourRobot)
+	}
+	if got := anim.Image[0].At(int(x), int(y)); got != colourBackground {
+		t.Errorf("square 1,0 in frame 0 = %v, want %v", got, colourBackground)
+	}
+
+	if err := RenderGIF(&buf, nil); err == nil {
+		t.Error("RenderGIF with no frames should fail")
+	}
+
+	// Each program run starts a new recording
+	err = robot.RunProgram("REPORT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(robot.Frames) != 0 {
+		t.Errorf("frames from the last program weren't cleared: %v", robot.Frames)
+	}
+
+	err = robot.RunProgram("0 0 NORTH PLACE 3000 { RIGHT } TIMES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(robot.Frames); n > MaxFrames || n < MaxFrames/2 {
+		t.Errorf("kept %d frames, want between %d and %d", n, MaxFrames/2, MaxFrames)
+	}
+	if last := robot.Frames[len(robot.Frames)-1]; last.F != robot.F {
+		t.Errorf("last frame faces %s, want %s", last.F, robot.F)
+	}
+}
@@ -2,6 +2,8 @@ package toyrobot
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/danwhitford/toyrobot/stack"
 )
@@ -10,7 +12,11 @@ import (
 func (r *Robot) LoadEnv() {
 	// Robot stuff
 	r.Dictionary["BOARD"] = r.printBoard
+	r.Dictionary["BOARD-STYLE"] = r.setBoardStyle
+	r.Dictionary["SAVE-SVG"] = r.saveSVG
+	r.Dictionary["SAVE-PNG"] = r.savePNG
 	r.Dictionary["REPORT"] = r.report
+	r.Dictionary["REPORT-JSON"] = r.reportJSON
 	r.Dictionary["RIGHT"] = r.right
 	r.Dictionary["LEFT"] = r.left
 	r.Dictionary["MOVE"] = r.move
@@ -21,6 +27,7 @@ func (r *Robot) LoadEnv() {
 	r.Dictionary["DUP"] = r.dup
 	r.Dictionary["V"] = r.v
 	r.Dictionary["CR"] = r.cr
+	r.Dictionary["FMT"] = r.format
 	r.Dictionary["DROP"] = r.drop
 	r.Dictionary["SWAP"] = r.swap
 	r.Dictionary["OVER"] = r.over
@@ -42,17 +49,171 @@ func (r *Robot) LoadEnv() {
 	r.Dictionary[">="] = r.gte
 	r.Dictionary["<>"] = r.neq
 
+	// Logic stuff
+	r.Dictionary["AND"] = r.and
+	r.Dictionary["OR"] = r.or
+	r.Dictionary["XOR"] = r.xor
+	r.Dictionary["NOT"] = r.not
+
+	// String stuff
+	r.Dictionary["LEN"] = r.length
+	r.Dictionary["SUBSTR"] = r.substr
+	r.Dictionary["UPPER"] = r.upper
+	r.Dictionary["LOWER"] = r.lower
+	r.Dictionary["SPLIT"] = r.split
+	r.Dictionary[">STR"] = r.toStr
+	r.Dictionary[">NUM"] = r.toNum
+
+	// List stuff
+	r.Dictionary["["] = r.listStart
+	r.Dictionary["]"] = r.listEnd
+	r.Dictionary["NTH"] = r.nth
+	r.Dictionary["APPEND"] = r.appendList
+	r.Dictionary["EACH"] = r.each
+	r.Dictionary["MAP"] = r.mapList
+
+	// Quotation stuff
+	r.Dictionary["CALL"] = r.callWord
+	r.Dictionary["EXECUTE"] = r.callWord
+	r.Dictionary["TIMES"] = r.times
+
 	// Conditional stuff
 	r.Dictionary["IF"] = r.ifStatement
 	r.Dictionary["JMP"] = r.jmp
+
+	// Error stuff
+	r.Dictionary["TRY"] = r.try
+	r.Dictionary["CATCH"] = r.endTry
+	r.Dictionary["THROW"] = r.throw
+
+	// Assertion stuff
+	r.Dictionary["ASSERT"] = r.assert
+	r.Dictionary["ASSERT="] = r.assertEq
+	r.Dictionary["ASSERT-POS"] = r.assertPos
+}
+
+// readAddr reads a two byte jump target from the instructions.
+func (r *Robot) readAddr() (int, error) {
+	hi, err := r.Instructions.GetNext()
+	if err != nil {
+		return 0, err
+	}
+	lo, err := r.Instructions.GetNext()
+	if err != nil {
+		return 0, err
+	}
+	return int(hi)<<8 | int(lo), nil
 }
 
 func (r *Robot) jmp() error {
-	skipTo, err := r.Instructions.GetNext()
+	skipTo, err := r.readAddr()
+	if err != nil {
+		return err
+	}
+	r.Instructions.Ptr = skipTo
+	return nil
+}
+
+func (r *Robot) try() error {
+	catchAt, err := r.readAddr()
+	if err != nil {
+		return err
+	}
+	r.handlers.Push(handler{
+		catch:        catchAt,
+		stack:        append([]RobotValue(nil), *r.RobotValueStack...),
+		marks:        len(r.listMarks),
+		instructions: r.Instructions,
+	})
+	return nil
+}
+
+// endTry runs when a TRY body finishes without an error, so the handler is
+// no longer needed and the CATCH body is skipped.
+func (r *Robot) endTry() error {
+	skipTo, err := r.readAddr()
+	if err != nil {
+		return err
+	}
+	_, err = r.handlers.Pop()
+	if err != nil {
+		return fmt.Errorf("CATCH without TRY")
+	}
+	r.Instructions.Ptr = skipTo
+	return nil
+}
+
+func (r *Robot) throw() error {
+	v, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
+	}
+	return &ThrownError{Value: v}
+}
+
+// assertionFailed builds the error for a failed assertion.
+func (r *Robot) assertionFailed(msg string) error {
+	pos, ok := r.position()
+	return &AssertionError{Pos: pos, HasPos: ok, Msg: msg, Robot: r.state()}
+}
+
+// ( cond [msg] -- )
+func (r *Robot) assert() error {
+	v, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
+	}
+	msg := "condition was false"
+	if v.Type == T_STRING {
+		msg = v.Value.(string)
+		v, err = r.RobotValueStack.Pop()
+		if err != nil {
+			return err
+		}
+	}
+	if v.Type != T_BOOL {
+		return &TypeMismatchError{Word: "ASSERT", Expected: []RobotType{T_BOOL}, Actual: v.Type}
+	}
+	if !v.Value.(bool) {
+		return r.assertionFailed(msg)
+	}
+	return nil
+}
+
+// ( actual expected -- )
+func (r *Robot) assertEq() error {
+	expected, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
+	}
+	actual, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
+	}
+	if actual.Type != expected.Type || actual.Literal() != expected.Literal() {
+		return r.assertionFailed(fmt.Sprintf("expected %s, got %s", expected.Literal(), actual.Literal()))
+	}
+	return nil
+}
+
+// ( x y f -- )
+func (r *Robot) assertPos() error {
+	f, err := r.popType(T_DIRECTION, "ASSERT-POS")
+	if err != nil {
+		return err
+	}
+	y, err := r.popType(T_INT, "ASSERT-POS")
+	if err != nil {
+		return err
+	}
+	x, err := r.popType(T_INT, "ASSERT-POS")
 	if err != nil {
 		return err
 	}
-	r.Instructions.Ptr = int(skipTo)
+	want := fmt.Sprintf("%d,%d,%s", x.Value, y.Value, f.Value)
+	if !r.Placed || want != r.state() {
+		return r.assertionFailed(fmt.Sprintf("expected robot at %s", want))
+	}
 	return nil
 }
 
@@ -62,15 +223,15 @@ func (r *Robot) ifStatement() error {
 		return err
 	}
 	if cond.Type != T_BOOL {
-		return fmt.Errorf("expected bool for IF, got %s", cond.Type)
+		return &TypeMismatchError{Word: "IF", Expected: []RobotType{T_BOOL}, Actual: cond.Type}
 	}
-	skipTo, err := r.Instructions.GetNext()
+	skipTo, err := r.readAddr()
 	if err != nil {
 		return err
 	}
 
 	if !cond.Value.(bool) {
-		r.Instructions.Ptr = int(skipTo)
+		r.Instructions.Ptr = skipTo
 	}
 	return nil
 }
@@ -140,6 +301,7 @@ func (r *Robot) drop() error {
 
 func (r *Robot) clear() error {
 	r.RobotValueStack = &stack.RobotStack[RobotValue]{}
+	r.listMarks = nil
 	return nil
 }
 
@@ -150,16 +312,11 @@ func (r *Robot) cr() error {
 
 func (r *Robot) v() error {
 	if len(*r.RobotValueStack) == 0 {
-		return fmt.Errorf("stack is empty")
+		return ErrStackUnderflow
 	}
 
 	for _, el := range *r.RobotValueStack {
-		switch el.Type {
-		case T_STRING:
-			fmt.Fprintf(r.Output, "%#v\n", el.Value)
-		default:
-			fmt.Fprintln(r.Output, el.Value)
-		}
+		fmt.Fprintln(r.Output, el.Literal())
 	}
 	return nil
 }
@@ -169,37 +326,120 @@ func (r *Robot) prn() error {
 	if err != nil {
 		return err
 	}
-	fmt.Fprintln(r.Output, top.Value)
+	fmt.Fprintln(r.Output, top)
 	return nil
 }
 
-func (r *Robot) printBoard() error {
-	hr := "+---+---+---+---+---+\n"
-	cage := "| %s | %s | %s | %s | %s |\n"
-	for y := 4; y >= 0; y-- {
-		x := make([]interface{}, 5)
-		for i := range x {
-			x[i] = " "
+// ( v1 ... vn format -- )
+func (r *Robot) format() error {
+	f, err := r.popType(T_STRING, "FMT")
+	if err != nil {
+		return err
+	}
+	format := f.Value.(string)
+	operands, err := parseVerbs(format)
+	if err != nil {
+		return err
+	}
+	args := make([]any, len(operands))
+	for i := len(args) - 1; i >= 0; i-- {
+		v, err := r.RobotValueStack.Pop()
+		if err != nil {
+			return err
 		}
-		if r.Placed && r.Y == y {
-			switch r.F {
-			case NORTH:
-				x[r.X] = "^"
-			case EAST:
-				x[r.X] = ">"
-			case SOUTH:
-				x[r.X] = "v"
-			case WEST:
-				x[r.X] = "<"
+		for _, verb := range operands[i] {
+			expected := verbTypes[verb]
+			if expected != nil && !hasType(expected, v.Type) {
+				return &TypeMismatchError{Word: "FMT", Expected: expected, Actual: v.Type}
 			}
 		}
-		fmt.Fprint(r.Output, hr)
-		fmt.Fprintf(r.Output, cage, x...)
+		args[i] = v.Value
+		if v.Type == T_LIST || v.Type == T_QUOTE {
+			args[i] = v.String()
+		}
 	}
-	fmt.Fprint(r.Output, hr)
+	fmt.Fprintf(r.Output, format, args...)
 	return nil
 }
 
+// verbTypes is the types each Printf verb can format, with * for a width or
+// precision. Verbs with no entry here, like %v, take anything.
+var verbTypes = map[byte][]RobotType{
+	'*': {T_INT},
+	'd': {T_INT},
+	'b': {T_INT},
+	'o': {T_INT},
+	'c': {T_INT},
+	'U': {T_INT},
+	'x': {T_INT, T_STRING},
+	'X': {T_INT, T_STRING},
+	't': {T_BOOL},
+	's': {T_STRING, T_DIRECTION, T_LIST, T_QUOTE},
+	'q': {T_STRING, T_DIRECTION, T_LIST, T_QUOTE},
+}
+
+func hasType(types []RobotType, t RobotType) bool {
+	for _, ty := range types {
+		if ty == t {
+			return true
+		}
+	}
+	return false
+}
+
+// parseVerbs returns the verbs that use each operand of a Printf style format
+// string, following explicit indexes like %[2]d the way fmt does.
+func parseVerbs(format string) ([][]byte, error) {
+	var operands [][]byte
+	use := func(n int, verb byte) {
+		for len(operands) <= n {
+			operands = append(operands, nil)
+		}
+		operands[n] = append(operands[n], verb)
+	}
+	arg := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		for i++; i < len(format); i++ {
+			c := format[i]
+			switch {
+			case c == '[':
+				end := strings.IndexByte(format[i:], ']')
+				if end < 0 {
+					return nil, fmt.Errorf("bad argument index in format %q", format)
+				}
+				n, err := strconv.Atoi(format[i+1 : i+end])
+				if err != nil || n < 1 {
+					return nil, fmt.Errorf("bad argument index in format %q", format)
+				}
+				arg = n - 1
+				i += end
+				continue
+			case c == '*':
+				use(arg, c)
+				arg++
+				continue
+			case strings.IndexByte("+-# 0123456789.", c) >= 0:
+				continue
+			case c != '%':
+				use(arg, c)
+				arg++
+			}
+			break
+		}
+	}
+	return operands, nil
+}
+
+// BoardSize is the width and height of the table the robot moves on.
+const BoardSize = 5
+
+func onBoard(x, y int) bool {
+	return x >= 0 && x < BoardSize && y >= 0 && y < BoardSize
+}
+
 func (r *Robot) place() error {
 	fv, err := r.RobotValueStack.Pop()
 	if err != nil {
@@ -216,28 +456,30 @@ func (r *Robot) place() error {
 
 	f, ok := fv.Value.(Direction)
 	if !ok {
-		return fmt.Errorf("invalid direction %v", fv.Value)
+		return &TypeMismatchError{Word: "PLACE", Expected: []RobotType{T_DIRECTION}, Actual: fv.Type}
 	}
 	y, ok := yv.Value.(int)
 	if !ok {
-		return fmt.Errorf("invalid y %v", yv.Value)
+		return &TypeMismatchError{Word: "PLACE", Expected: []RobotType{T_INT}, Actual: yv.Type}
 	}
 	x, ok := xv.Value.(int)
 	if !ok {
-		return fmt.Errorf("invalid x %v", xv.Value)
+		return &TypeMismatchError{Word: "PLACE", Expected: []RobotType{T_INT}, Actual: xv.Type}
 	}
 
-	if x < 0 || x > 4 || y < 0 || y > 4 {
+	if !onBoard(x, y) {
 		return nil
 	}
 	if f < NORTH || f > WEST {
-		return fmt.Errorf("invalid facing %v", f)
+		return &InvalidFacingError{Facing: f}
 	}
 
 	r.X = x
 	r.Y = y
 	r.F = f
 	r.Placed = true
+	r.Trail = newTrail(Point{x, y})
+	r.record()
 	return nil
 }
 
@@ -246,13 +488,14 @@ func (r *Robot) move() error {
 		return nil
 	}
 
+	from := Point{r.X, r.Y}
 	switch r.F {
 	case NORTH:
-		if r.Y < 4 {
+		if r.Y < BoardSize-1 {
 			r.Y++
 		}
 	case EAST:
-		if r.X < 4 {
+		if r.X < BoardSize-1 {
 			r.X++
 		}
 	case SOUTH:
@@ -264,6 +507,8 @@ func (r *Robot) move() error {
 			r.X--
 		}
 	}
+	r.Trail.add(from, Point{r.X, r.Y})
+	r.record()
 	return nil
 }
 
@@ -282,6 +527,7 @@ func (r *Robot) left() error {
 	case WEST:
 		r.F = SOUTH
 	}
+	r.record()
 	return nil
 }
 
@@ -300,11 +546,15 @@ func (r *Robot) right() error {
 	case WEST:
 		r.F = NORTH
 	}
+	r.record()
 	return nil
 }
 
 // Implement REPORT
 func (r *Robot) report() error {
+	if r.ReportFormat == REPORT_JSON {
+		return r.reportJSON()
+	}
 	if !r.Placed {
 		fmt.Fprintln(r.Output, "Robot not placed")
 		return nil
@@ -312,3 +562,237 @@ func (r *Robot) report() error {
 	fmt.Fprintf(r.Output, "%d,%d,%s\n", r.X, r.Y, r.F)
 	return nil
 }
+
+func (r *Robot) popType(t RobotType, word string) (RobotValue, error) {
+	v, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return v, err
+	}
+	if v.Type != t {
+		return v, &TypeMismatchError{Word: word, Expected: []RobotType{t}, Actual: v.Type}
+	}
+	return v, nil
+}
+
+func (r *Robot) length() error {
+	v, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
+	}
+	switch v.Type {
+	case T_STRING:
+		r.RobotValueStack.Push(RobotValue{Type: T_INT, Value: len([]rune(v.Value.(string)))})
+	case T_LIST:
+		r.RobotValueStack.Push(RobotValue{Type: T_INT, Value: len(v.Value.([]RobotValue))})
+	default:
+		return &TypeMismatchError{Word: "LEN", Expected: []RobotType{T_STRING, T_LIST}, Actual: v.Type}
+	}
+	return nil
+}
+
+// ( s start count -- s' )
+func (r *Robot) substr() error {
+	count, err := r.popType(T_INT, "SUBSTR")
+	if err != nil {
+		return err
+	}
+	start, err := r.popType(T_INT, "SUBSTR")
+	if err != nil {
+		return err
+	}
+	s, err := r.popType(T_STRING, "SUBSTR")
+	if err != nil {
+		return err
+	}
+	runes := []rune(s.Value.(string))
+	from, n := start.Value.(int), count.Value.(int)
+	if from < 0 || n < 0 || from > len(runes) || n > len(runes)-from {
+		return &RangeError{Word: "SUBSTR", Start: from, Count: n, Length: len(runes)}
+	}
+	r.RobotValueStack.Push(RobotValue{Type: T_STRING, Value: string(runes[from : from+n])})
+	return nil
+}
+
+func (r *Robot) upper() error {
+	s, err := r.popType(T_STRING, "UPPER")
+	if err != nil {
+		return err
+	}
+	r.RobotValueStack.Push(RobotValue{Type: T_STRING, Value: strings.ToUpper(s.Value.(string))})
+	return nil
+}
+
+func (r *Robot) lower() error {
+	s, err := r.popType(T_STRING, "LOWER")
+	if err != nil {
+		return err
+	}
+	r.RobotValueStack.Push(RobotValue{Type: T_STRING, Value: strings.ToLower(s.Value.(string))})
+	return nil
+}
+
+// ( s sep -- p1 ... pn n )
+func (r *Robot) split() error {
+	sep, err := r.popType(T_STRING, "SPLIT")
+	if err != nil {
+		return err
+	}
+	s, err := r.popType(T_STRING, "SPLIT")
+	if err != nil {
+		return err
+	}
+	pieces := strings.Split(s.Value.(string), sep.Value.(string))
+	for _, p := range pieces {
+		r.RobotValueStack.Push(RobotValue{Type: T_STRING, Value: p})
+	}
+	r.RobotValueStack.Push(RobotValue{Type: T_INT, Value: len(pieces)})
+	return nil
+}
+
+func (r *Robot) toStr() error {
+	v, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
+	}
+	return r.pushSized(RobotValue{Type: T_STRING, Value: v.String()})
+}
+
+func (r *Robot) toNum() error {
+	s, err := r.popType(T_STRING, ">NUM")
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s.Value.(string)))
+	if err != nil {
+		return &ConversionError{Word: ">NUM", Value: s.Value.(string)}
+	}
+	r.RobotValueStack.Push(RobotValue{Type: T_INT, Value: n})
+	return nil
+}
+
+func (r *Robot) listStart() error {
+	r.listMarks.Push(len(*r.RobotValueStack))
+	return nil
+}
+
+func (r *Robot) listEnd() error {
+	mark, err := r.listMarks.Pop()
+	if err != nil {
+		return ErrUnmatchedList
+	}
+	if mark > len(*r.RobotValueStack) {
+		return ErrListUnderflow
+	}
+	items := make([]RobotValue, len(*r.RobotValueStack)-mark)
+	copy(items, (*r.RobotValueStack)[mark:])
+	*r.RobotValueStack = (*r.RobotValueStack)[:mark]
+	return r.pushSized(RobotValue{Type: T_LIST, Value: items})
+}
+
+// ( list i -- v )
+func (r *Robot) nth() error {
+	i, err := r.popType(T_INT, "NTH")
+	if err != nil {
+		return err
+	}
+	l, err := r.popType(T_LIST, "NTH")
+	if err != nil {
+		return err
+	}
+	items := l.Value.([]RobotValue)
+	idx := i.Value.(int)
+	if idx < 0 || idx >= len(items) {
+		return &IndexError{Word: "NTH", Index: idx, Length: len(items)}
+	}
+	r.RobotValueStack.Push(items[idx])
+	return nil
+}
+
+// ( list v -- list' )
+func (r *Robot) appendList() error {
+	v, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
+	}
+	l, err := r.popType(T_LIST, "APPEND")
+	if err != nil {
+		return err
+	}
+	items := l.Value.([]RobotValue)
+	appended := make([]RobotValue, len(items), len(items)+1)
+	copy(appended, items)
+	return r.pushSized(RobotValue{Type: T_LIST, Value: append(appended, v)})
+}
+
+func (r *Robot) callWord() error {
+	q, err := r.popType(T_QUOTE, "CALL")
+	if err != nil {
+		return err
+	}
+	return r.call(q.Value.(Quotation))
+}
+
+// ( n quote -- )
+func (r *Robot) times() error {
+	q, err := r.popType(T_QUOTE, "TIMES")
+	if err != nil {
+		return err
+	}
+	n, err := r.popType(T_INT, "TIMES")
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n.Value.(int); i++ {
+		err = r.call(q.Value.(Quotation))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ( list quote -- )
+func (r *Robot) each() error {
+	q, err := r.popType(T_QUOTE, "EACH")
+	if err != nil {
+		return err
+	}
+	l, err := r.popType(T_LIST, "EACH")
+	if err != nil {
+		return err
+	}
+	for _, item := range l.Value.([]RobotValue) {
+		r.RobotValueStack.Push(item)
+		err = r.call(q.Value.(Quotation))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ( list quote -- list' )
+func (r *Robot) mapList() error {
+	q, err := r.popType(T_QUOTE, "MAP")
+	if err != nil {
+		return err
+	}
+	l, err := r.popType(T_LIST, "MAP")
+	if err != nil {
+		return err
+	}
+	items := l.Value.([]RobotValue)
+	mapped := make([]RobotValue, len(items))
+	for i, item := range items {
+		r.RobotValueStack.Push(item)
+		err = r.call(q.Value.(Quotation))
+		if err != nil {
+			return err
+		}
+		mapped[i], err = r.RobotValueStack.Pop()
+		if err != nil {
+			return err
+		}
+	}
+	return r.pushSized(RobotValue{Type: T_LIST, Value: mapped})
+}
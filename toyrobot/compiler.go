@@ -1,10 +1,9 @@
 package toyrobot
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
-
-	"github.com/danwhitford/toyrobot/belt"
-	"github.com/danwhitford/toyrobot/stack"
 )
 
 //go:generate stringer -type=Instruction
@@ -15,127 +14,226 @@ const (
 	OP_EXEC_WORD
 )
 
-type IfFrame struct {
-	Location     int
-	elseLocation *int
-}
-
 type RobotCompiler struct {
-	tokens  *belt.Belt[Token]
-	ifStack stack.RobotStack[IfFrame]
+	// Words numbers the words the compiled code refers to. It is shared
+	// by everything compiled for the same robot.
+	Words *WordTable
+
+	// SourceMap maps the offset of each compiled instruction to the position
+	// of the token it came from.
+	SourceMap map[int]Position
 }
 
 func (r *RobotCompiler) Compile(input []Token) ([]byte, error) {
-	r.tokens = belt.NewBelt[Token](input)
+	nodes, err := (&RobotParser{}).Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return r.CompileAST(nodes)
+}
+
+// CompileAST generates code for a parsed program.
+func (r *RobotCompiler) CompileAST(nodes []Node) ([]byte, error) {
+	if r.Words == nil {
+		r.Words = NewWordTable()
+	}
+	r.SourceMap = make(map[int]Position)
+	return r.compileNodes(nodes, make([]byte, 0))
+}
 
-	instructions := make([]byte, 0)
-	for r.tokens.HasNext() {
-		token, err := r.tokens.GetNext()
+func (r *RobotCompiler) compileNodes(nodes []Node, instructions []byte) ([]byte, error) {
+	for _, node := range nodes {
+		var err error
+		instructions, err = r.compileNode(node, instructions)
 		if err != nil {
-			return nil, err
-		}
-		switch token.Type {
-		case TOKEN_NUMBER:
-			instructions = append(
-				instructions,
-				byte(OP_PUSH_VAL),
-				byte(T_INT),
-				byte(token.Value.(int)),
-			)
-		case TOKEN_DIRECTION:
-			instructions = append(
-				instructions,
-				byte(OP_PUSH_VAL),
-				byte(T_DIRECTION),
-				byte(token.Value.(Direction)),
-			)
-		case TOKEN_WORD:
-			tokenVal, ok := token.Value.(string)
-			if !ok {
-				return nil, fmt.Errorf("invalid token value '%v'", token.Value)
-			}
-			switch tokenVal {
-			case "IF":
-				instructions = append(
-					instructions,
-					byte(OP_EXEC_WORD),
-					'I', 'F', 0, 0, // placeholder for THEN location
-				)
-				r.ifStack.Push(IfFrame{
-					Location: len(instructions),
-				})
-			case "THEN":
-				ifFrame, err := r.ifStack.Pop()
-				if err != nil {
-					return nil, err
-				}
-				if ifFrame.elseLocation == nil {
-					// IF will jump straight here if false
-					instructions[ifFrame.Location-1] = byte(len(instructions))
-				} else {
-					// Set instruction at ELSE location to jump here
-					instructions[*ifFrame.elseLocation-1] = byte(len(instructions))
-				}
-			case "ELSE":
-				ifFrame, err := r.ifStack.Pop()
-				if err != nil {
-					return nil, err
-				}
-				// Put a JUMP instruction here with a placeholder for the location
-				instructions = append(instructions, byte(OP_EXEC_WORD), 'J', 'M', 'P', 0, 0)
-				// Set the IF instruction to jump here if the IF condition is false
-				here := len(instructions)
-				instructions[ifFrame.Location-1] = byte(here)
-
-				// Push the new IF location onto the stack
-				ifFrame.elseLocation = &here
-				r.ifStack.Push(ifFrame)
-			default:
-				bytes := append([]byte(tokenVal), 0)
-				instructions = append(
-					instructions,
-					byte(OP_EXEC_WORD),
-				)
-				instructions = append(
-					instructions,
-					bytes...,
-				)
-			}
-		case TOKEN_BOOL:
-			boolVal, ok := token.Value.(bool)
-			if !ok {
-				return nil, fmt.Errorf("invalid token value '%v'", token.Value)
-			}
-			var byt byte
-			if boolVal {
-				byt = 1
+			var compileErr *CompileError
+			if errors.As(err, &compileErr) {
+				return nil, err
 			}
+			return nil, &CompileError{Pos: node.Pos(), Err: err}
+		}
+	}
+	return instructions, nil
+}
 
-			instructions = append(
-				instructions,
-				byte(OP_PUSH_VAL),
-				byte(T_BOOL),
-				byt,
-			)
-		case TOKEN_STRING:
-			tokenVal, ok := token.Value.(string)
-			if !ok {
-				return nil, fmt.Errorf("invalid token value '%v'", token.Value)
-			}
-			bytes := append([]byte(tokenVal), 0)
-			instructions = append(
-				instructions,
-				byte(OP_PUSH_VAL),
-				byte(T_STRING),
-			)
-			instructions = append(
-				instructions,
-				bytes...,
-			)
-		default:
-			return nil, fmt.Errorf("invalid instruction '%v'", token)
+// compileNode appends the code for a single node to instructions.
+func (r *RobotCompiler) compileNode(node Node, instructions []byte) ([]byte, error) {
+	r.SourceMap[len(instructions)] = node.Pos()
+	switch n := node.(type) {
+	case *Literal:
+		return compileLiteral(n.Token, instructions)
+	case *WordCall:
+		return r.appendWord(instructions, n.Word())
+	case *QuotationNode:
+		quote, err := r.compileQuotation(n, len(instructions))
+		if err != nil {
+			return instructions, err
+		}
+		return append(instructions, quote...), nil
+	case *Conditional:
+		// IF jumps past the THEN branch when the condition is false
+		instructions, err := r.appendJump(instructions, "IF")
+		if err != nil {
+			return instructions, err
+		}
+		ifLocation := len(instructions)
+		instructions, err = r.compileNodes(n.Then, instructions)
+		if err != nil {
+			return instructions, err
+		}
+		if n.ElseToken == nil {
+			return instructions, patchAddr(instructions, ifLocation, len(instructions))
+		}
+		// The THEN branch finishes by jumping over the ELSE branch
+		r.SourceMap[len(instructions)] = n.ElseToken.Pos
+		instructions, err = r.appendJump(instructions, "JMP")
+		if err != nil {
+			return instructions, err
+		}
+		elseLocation := len(instructions)
+		err = patchAddr(instructions, ifLocation, elseLocation)
+		if err != nil {
+			return instructions, err
+		}
+		instructions, err = r.compileNodes(n.Else, instructions)
+		if err != nil {
+			return instructions, err
+		}
+		return instructions, patchAddr(instructions, elseLocation, len(instructions))
+	case *TryCatch:
+		// TRY records where the handler is
+		instructions, err := r.appendJump(instructions, "TRY")
+		if err != nil {
+			return instructions, err
+		}
+		tryLocation := len(instructions)
+		instructions, err = r.compileNodes(n.Body, instructions)
+		if err != nil {
+			return instructions, err
+		}
+		// Leaving the TRY body normally skips over the handler
+		r.SourceMap[len(instructions)] = n.Catch.Pos
+		instructions, err = r.appendJump(instructions, "CATCH")
+		if err != nil {
+			return instructions, err
+		}
+		catchLocation := len(instructions)
+		err = patchAddr(instructions, tryLocation, catchLocation)
+		if err != nil {
+			return instructions, err
+		}
+		instructions, err = r.compileNodes(n.Handler, instructions)
+		if err != nil {
+			return instructions, err
+		}
+		return instructions, patchAddr(instructions, catchLocation, len(instructions))
+	default:
+		return instructions, fmt.Errorf("invalid node %T", node)
+	}
+}
+
+// compileLiteral appends the code to push a literal token.
+func compileLiteral(token Token, instructions []byte) ([]byte, error) {
+	switch token.Type {
+	case TOKEN_NUMBER:
+		return appendValue(instructions, RobotValue{Type: T_INT, Value: token.Value.(int)})
+	case TOKEN_DIRECTION:
+		return appendValue(instructions, RobotValue{Type: T_DIRECTION, Value: token.Value.(Direction)})
+	case TOKEN_BOOL:
+		boolVal, ok := token.Value.(bool)
+		if !ok {
+			return instructions, fmt.Errorf("invalid token value '%v'", token.Value)
+		}
+		return appendValue(instructions, RobotValue{Type: T_BOOL, Value: boolVal})
+	case TOKEN_STRING:
+		tokenVal, ok := token.Value.(string)
+		if !ok {
+			return instructions, fmt.Errorf("invalid token value '%v'", token.Value)
 		}
+		return appendValue(instructions, RobotValue{Type: T_STRING, Value: tokenVal})
+	default:
+		return instructions, fmt.Errorf("invalid instruction '%v'", token)
 	}
+}
 
-	return instructions, nil
+// appendValue appends an instruction to push a literal value. Ints are
+// stored as zig-zag varints, strings are NUL terminated. Lists and
+// quotations have no literal form.
+func appendValue(instructions []byte, v RobotValue) ([]byte, error) {
+	switch v.Type {
+	case T_INT:
+		instructions = append(instructions, byte(OP_PUSH_VAL), byte(v.Type))
+		return binary.AppendVarint(instructions, int64(v.Value.(int))), nil
+	case T_DIRECTION:
+		return append(instructions, byte(OP_PUSH_VAL), byte(v.Type), byte(v.Value.(Direction))), nil
+	case T_BOOL:
+		var byt byte
+		if v.Value.(bool) {
+			byt = 1
+		}
+		return append(instructions, byte(OP_PUSH_VAL), byte(v.Type), byt), nil
+	case T_STRING:
+		instructions = append(instructions, byte(OP_PUSH_VAL), byte(v.Type))
+		instructions = append(instructions, []byte(v.Value.(string))...)
+		return append(instructions, 0), nil
+	default:
+		return instructions, fmt.Errorf("can't compile a literal %s", v.Type)
+	}
+}
+
+// appendWord appends an instruction to run a word, which is referred to by
+// its index in the word table.
+func (r *RobotCompiler) appendWord(instructions []byte, word string) ([]byte, error) {
+	i, err := r.Words.Intern(word)
+	if err != nil {
+		return instructions, err
+	}
+	return append(instructions, byte(OP_EXEC_WORD), byte(i>>8), byte(i)), nil
+}
+
+// appendJump appends a word followed by a placeholder for its jump address.
+func (r *RobotCompiler) appendJump(instructions []byte, word string) ([]byte, error) {
+	instructions, err := r.appendWord(instructions, word)
+	if err != nil {
+		return instructions, err
+	}
+	return append(instructions, 0, 0), nil
+}
+
+// patchAddr fills in the two byte jump target placeholder that ends just
+// before location. It fails if addr doesn't fit in two bytes.
+func patchAddr(instructions []byte, location int, addr int) error {
+	if addr > 0xffff {
+		return fmt.Errorf("code too long to jump to offset %d", addr)
+	}
+	instructions[location-2] = byte(addr >> 8)
+	instructions[location-1] = byte(addr)
+	return nil
+}
+
+// compileQuotation compiles the body of a quotation into its own block of
+// code so that jumps inside it are relative to the block. The block will be
+// placed at offset at.
+func (r *RobotCompiler) compileQuotation(n *QuotationNode, at int) ([]byte, error) {
+	inner := RobotCompiler{Words: r.Words}
+	code, err := inner.CompileAST(n.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) > 0xffff {
+		return nil, fmt.Errorf("quotation too long")
+	}
+
+	instructions := []byte{
+		byte(OP_PUSH_VAL),
+		byte(T_QUOTE),
+		byte(len(code) >> 8),
+		byte(len(code)),
+	}
+	for offset, pos := range inner.SourceMap {
+		r.SourceMap[at+len(instructions)+offset] = pos
+	}
+	instructions = append(instructions, code...)
+	instructions = append(instructions, []byte(n.Source())...)
+	return append(instructions, 0), nil
 }
@@ -1,6 +1,8 @@
 package toyrobot
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -10,6 +12,7 @@ func TestCompile(t *testing.T) {
 	table := []struct {
 		input []Token
 		want  []byte
+		words []string
 	}{
 		{
 			input: []Token{
@@ -37,16 +40,17 @@ func TestCompile(t *testing.T) {
 			want: []byte{
 				byte(OP_PUSH_VAL),
 				byte(T_INT),
-				byte(0),
+				0, // 0
 				byte(OP_PUSH_VAL),
 				byte(T_INT),
-				byte(0),
+				0, // 0
 				byte(OP_PUSH_VAL),
 				byte(T_DIRECTION),
 				byte(NORTH),
 				byte(OP_EXEC_WORD),
-				'P', 'L', 'A', 'C', 'E', 0,
+				0, 0,
 			},
+			words: []string{"PLACE"},
 		},
 		{
 			input: []Token{
@@ -57,102 +61,128 @@ func TestCompile(t *testing.T) {
 				},
 			},
 			want: []byte{
-				byte(OP_EXEC_WORD), 'M', 'O', 'V', 'E', 0,
+				byte(OP_EXEC_WORD), 0, 0,
 			},
+			words: []string{"MOVE"},
 		},
 		{
 			input: []Token{
-				{TOKEN_BOOL, true, "true"},
-				{TOKEN_WORD, "IF", "IF"},
-				{TOKEN_STRING, "hello", "\"hello\""},
-				{TOKEN_WORD, ".", "."},
-				{TOKEN_WORD, "THEN", "THEN"},
+				{TOKEN_BOOL, true, "true", Position{}},
+				{TOKEN_WORD, "IF", "IF", Position{}},
+				{TOKEN_STRING, "hello", "\"hello\"", Position{}},
+				{TOKEN_WORD, ".", ".", Position{}},
+				{TOKEN_WORD, "THEN", "THEN", Position{}},
 			},
 			want: []byte{
 				byte(OP_PUSH_VAL),
 				byte(T_BOOL),
 				byte(1),
 				byte(OP_EXEC_WORD),
-				'I', 'F', 0,
-				19,
+				0, 0,
+				0, 19,
 				byte(OP_PUSH_VAL),
 				byte(T_STRING),
 				'h', 'e', 'l', 'l', 'o', 0,
 				byte(OP_EXEC_WORD),
-				'.', 0,
+				0, 1,
 			},
+			words: []string{"IF", "."},
 		},
 		{
 			input: []Token{
-				{TOKEN_NUMBER, 5, "5"},
-				{TOKEN_WORD, "DUP", "DUP"},
-				{TOKEN_NUMBER, 5, "5"},
-				{TOKEN_WORD, "EQ", "EQ"},
-				{TOKEN_WORD, "IF", "IF"},
-				{TOKEN_STRING, "5", "\"5\""},
-				{TOKEN_WORD, ".", "."},
-				{TOKEN_WORD, "ELSE", "ELSE"},
-				{TOKEN_WORD, "DUP", "DUP"},
-				{TOKEN_NUMBER, 5, "5"},
-				{TOKEN_WORD, "GT", "GT"},
-				{TOKEN_WORD, "IF", "IF"},
-				{TOKEN_STRING, "BIGUN", "\"BIGUN\""},
-				{TOKEN_WORD, ".", "."},
-				{TOKEN_WORD, "ELSE", "ELSE"},
-				{TOKEN_STRING, "SMALLUN", "\"SMALLUN\""},
-				{TOKEN_WORD, ".", "."},
-				{TOKEN_WORD, "THEN", "THEN"},
-				{TOKEN_WORD, "THEN", "THEN"},
-				{TOKEN_WORD, "DROP", "DROP"},
+				{TOKEN_NUMBER, 5, "5", Position{}},
+				{TOKEN_WORD, "DUP", "DUP", Position{}},
+				{TOKEN_NUMBER, 5, "5", Position{}},
+				{TOKEN_WORD, "EQ", "EQ", Position{}},
+				{TOKEN_WORD, "IF", "IF", Position{}},
+				{TOKEN_STRING, "5", "\"5\"", Position{}},
+				{TOKEN_WORD, ".", ".", Position{}},
+				{TOKEN_WORD, "ELSE", "ELSE", Position{}},
+				{TOKEN_WORD, "DUP", "DUP", Position{}},
+				{TOKEN_NUMBER, 5, "5", Position{}},
+				{TOKEN_WORD, "GT", "GT", Position{}},
+				{TOKEN_WORD, "IF", "IF", Position{}},
+				{TOKEN_STRING, "BIGUN", "\"BIGUN\"", Position{}},
+				{TOKEN_WORD, ".", ".", Position{}},
+				{TOKEN_WORD, "ELSE", "ELSE", Position{}},
+				{TOKEN_STRING, "SMALLUN", "\"SMALLUN\"", Position{}},
+				{TOKEN_WORD, ".", ".", Position{}},
+				{TOKEN_WORD, "THEN", "THEN", Position{}},
+				{TOKEN_WORD, "THEN", "THEN", Position{}},
+				{TOKEN_WORD, "DROP", "DROP", Position{}},
 			},
 			want: []byte{
 				byte(OP_PUSH_VAL), // 0
 				byte(T_INT),
-				byte(5),
-				byte(OP_EXEC_WORD),
-				'D', 'U', 'P', 0,
-				byte(OP_PUSH_VAL), // 8
+				10,                 // 5
+				byte(OP_EXEC_WORD), // 3
+				0, 0,               // DUP
+				byte(OP_PUSH_VAL), // 6
 				byte(T_INT),
-				byte(5), // 10
-				byte(OP_EXEC_WORD),
-				'E', 'Q', 0, // 14
-				byte(OP_EXEC_WORD), // 15
-				'I', 'F', 0,
-				0x21,
-				byte(OP_PUSH_VAL),
+				10,                 // 5
+				byte(OP_EXEC_WORD), // 9
+				0, 1,               // EQ
+				byte(OP_EXEC_WORD), // 12
+				0, 2,               // IF
+				0, 29,
+				byte(OP_PUSH_VAL), // 17
 				byte(T_STRING),
 				'5', 0,
-				byte(OP_EXEC_WORD),
-				'.', 0,
-				byte(OP_EXEC_WORD),
-				'J', 'M', 'P', 0,
-				0x50,
-				byte(OP_EXEC_WORD),
-				'D', 'U', 'P', 0,
-				byte(OP_PUSH_VAL),
+				byte(OP_EXEC_WORD), // 21
+				0, 3,               // .
+				byte(OP_EXEC_WORD), // 24
+				0, 4,               // JMP
+				0, 72,
+				byte(OP_EXEC_WORD), // 29
+				0, 0,               // DUP
+				byte(OP_PUSH_VAL), // 32
 				byte(T_INT),
-				byte(5), // 25
-				byte(OP_EXEC_WORD),
-				'G', 'T', 0,
-				byte(OP_EXEC_WORD),
-				'I', 'F', 0,
-				0x43, // 30
-				byte(OP_PUSH_VAL),
+				10,                 // 5
+				byte(OP_EXEC_WORD), // 35
+				0, 5,               // GT
+				byte(OP_EXEC_WORD), // 38
+				0, 2,               // IF
+				0, 59,
+				byte(OP_PUSH_VAL), // 43
 				byte(T_STRING),
 				'B', 'I', 'G', 'U', 'N', 0,
-				byte(OP_EXEC_WORD),
-				'.', 0, // 35
-				byte(OP_EXEC_WORD),
-				'J', 'M', 'P', 0,
-				0x50,
-				byte(OP_PUSH_VAL),
+				byte(OP_EXEC_WORD), // 51
+				0, 3,               // .
+				byte(OP_EXEC_WORD), // 54
+				0, 4,               // JMP
+				0, 72,
+				byte(OP_PUSH_VAL), // 59
 				byte(T_STRING),
 				'S', 'M', 'A', 'L', 'L', 'U', 'N', 0,
+				byte(OP_EXEC_WORD), // 69
+				0, 3,               // .
+				byte(OP_EXEC_WORD), // 72
+				0, 6,               // DROP
+			},
+			words: []string{"DUP", "EQ", "IF", ".", "JMP", "GT", "DROP"},
+		},
+		{
+			input: []Token{
+				{TOKEN_WORD, "{", "{", Position{}},
+				{TOKEN_NUMBER, 1, "1", Position{}},
+				{TOKEN_WORD, ".", ".", Position{}},
+				{TOKEN_WORD, "}", "}", Position{}},
+				{TOKEN_WORD, "CALL", "CALL", Position{}},
+			},
+			want: []byte{
+				byte(OP_PUSH_VAL),
+				byte(T_QUOTE),
+				0, 6,
+				byte(OP_PUSH_VAL),
+				byte(T_INT),
+				2, // 1
 				byte(OP_EXEC_WORD),
-				'.', 0,
+				0, 0,
+				'1', ' ', '.', 0,
 				byte(OP_EXEC_WORD),
-				'D', 'R', 'O', 'P', 0,
+				0, 1,
 			},
+			words: []string{".", "CALL"},
 		},
 	}
 
@@ -165,5 +195,125 @@ func TestCompile(t *testing.T) {
 		if diff := cmp.Diff(test.want, got); diff != "" {
 			t.Errorf("Compile(%v) returned unexpected diff (-want +got):\n%s", test.input, diff)
 		}
+		if diff := cmp.Diff(test.words, compiler.Words.names); diff != "" {
+			t.Errorf("Compile(%v) made unexpected word table (-want +got):\n%s", test.input, diff)
+		}
+	}
+}
+
+func TestOptimise(t *testing.T) {
+	table := []struct {
+		input, want string
+	}{
+		{"2 3 + .", "5 ."},
+		{"2 3 + 4 * .", "20 ."},
+		{"1 2 < NOT .", "FALSE ."},
+		{"\"a\" \"b\" + .", "\"ab\" ."},
+		{"1 0 / .", "1 0 / ."},
+		{"MOVE DUP DROP SWAP SWAP MOVE", "MOVE DUP DROP SWAP SWAP MOVE"},
+		{"1 DUP DROP .", "1 ."},
+		{"1 2 SWAP SWAP + .", "3 ."},
+		{"1 SWAP SWAP .", "1 SWAP SWAP ."},
+		{"{ MOVE } DUP DROP CALL", "{ MOVE } CALL"},
+		{"1 DROP MOVE", "MOVE"},
+		{"TRUE IF MOVE THEN REPORT", "MOVE REPORT"},
+		{"FALSE IF MOVE THEN REPORT", "REPORT"},
+		{"TRUE IF MOVE ELSE LEFT THEN REPORT", "MOVE REPORT"},
+		{"FALSE IF MOVE ELSE LEFT THEN REPORT", "LEFT REPORT"},
+		{"DUP IF 1 2 + ELSE 3 THEN", "DUP IF 3 ELSE 3 THEN"},
+	}
+
+	for _, tst := range table {
+		compiler := RobotCompiler{}
+		code, err := compile(&compiler, tst.input)
+		if err != nil {
+			t.Fatalf("compiling %q: %s", tst.input, err)
+		}
+		got, err := compiler.Optimise(code)
+		if err != nil {
+			t.Fatalf("optimising %q: %s", tst.input, err)
+		}
+		want, err := compile(&compiler, tst.want)
+		if err != nil {
+			t.Fatalf("compiling %q: %s", tst.want, err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Optimise(%q) mismatch (-want +got):\n%s", tst.input, diff)
+		}
+	}
+}
+
+// The optimiser mustn't turn a program that fails into one that doesn't
+func TestOptimiseKeepsErrors(t *testing.T) {
+	for _, program := range []string{"DUP DROP", "1 SWAP SWAP"} {
+		robot := NewRobot()
+		robot.Optimise = true
+		err := robot.RunProgram(program)
+		if !errors.Is(err, ErrStackUnderflow) {
+			t.Errorf("optimised %q should underflow, got %v", program, err)
+		}
+	}
+}
+
+func TestAppendValue(t *testing.T) {
+	_, err := appendValue(nil, RobotValue{Type: T_LIST, Value: []RobotValue{}})
+	if err == nil {
+		t.Error("appending a list literal should fail")
+	}
+}
+
+// Jumps can only reach the first 64k of code
+func TestJumpTooFar(t *testing.T) {
+	program := "FALSE IF " + strings.Repeat("1 DROP ", 20000) + `"then" . ELSE "else" . THEN`
+	for _, optimise := range []bool{false, true} {
+		robot := NewRobot()
+		robot.Optimise = optimise
+		err := robot.RunProgram(program)
+		var compileErr *CompileError
+		if !errors.As(err, &compileErr) {
+			t.Errorf("with Optimise %v, got %v, want a CompileError", optimise, err)
+		}
+	}
+}
+
+func TestOptimiseSourceMap(t *testing.T) {
+	compiler := RobotCompiler{}
+	code, err := compile(&compiler, "MOVE\n  2 3 +\n{ 1 1 + . }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := compiler.Optimise(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCode := []byte{
+		byte(OP_EXEC_WORD), 0, 0, // MOVE
+		byte(OP_PUSH_VAL), byte(T_INT), 10, // 5
+		byte(OP_PUSH_VAL), byte(T_QUOTE), 0, 6,
+		byte(OP_PUSH_VAL), byte(T_INT), 4, // 2
+		byte(OP_EXEC_WORD), 0, 2, // .
+		'1', ' ', '1', ' ', '+', ' ', '.', 0,
+	}
+	if diff := cmp.Diff(wantCode, got); diff != "" {
+		t.Errorf("code mismatch (-want +got):\n%s", diff)
+	}
+	want := map[int]Position{
+		0: {1, 1}, // MOVE
+		3: {2, 3}, // 2, which 2 3 + was folded into
+		6: {3, 1}, // {
+		// The quotation's code starts at 10
+		10: {3, 3}, // 1, which 1 1 + was folded into
+		13: {3, 9}, // .
+	}
+	if diff := cmp.Diff(want, compiler.SourceMap); diff != "" {
+		t.Errorf("source map mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func compile(compiler *RobotCompiler, program string) ([]byte, error) {
+	tokens, err := (&RobotTokeniser{}).Tokenise(program)
+	if err != nil {
+		return nil, err
 	}
+	return compiler.Compile(tokens)
 }
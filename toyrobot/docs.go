@@ -0,0 +1,91 @@
+package toyrobot
+
+// WordDocs describes the builtin words and the words the compiler handles
+// itself, starting with their stack effect.
+var WordDocs = map[string]string{
+	// Robot
+	"BOARD":       "( -- ) Print the board with the robot on it.",
+	"BOARD-STYLE": "( style -- ) Draw BOARD as \"ascii\" or \"unicode\". Unicode falls back to ASCII when the output isn't a terminal.",
+	"SAVE-SVG":    "( path -- ) Save a picture of the board, the robot and its trail as an SVG file. Fails unless whatever runs the program allows writing files.",
+	"SAVE-PNG":    "( path -- ) Save a picture of the board, the robot and its trail as a PNG file. Fails unless whatever runs the program allows writing files.",
+	"REPORT":      "( -- ) Print the robot's position and facing as X,Y,F.",
+	"REPORT-JSON": "( -- ) Print the robot's position, facing, the stack and the size of the board as a line of JSON.",
+	"RIGHT":       "( -- ) Turn the robot 90 degrees clockwise.",
+	"LEFT":        "( -- ) Turn the robot 90 degrees anticlockwise.",
+	"MOVE":        "( -- ) Move the robot one square forward unless it would fall off the board.",
+	"PLACE":       "( x y f -- ) Put the robot at x,y facing f. Ignored if x,y is off the board.",
+
+	// Stack
+	".":    "( v -- ) Print the top of the stack.",
+	"DUP":  "( a -- a a ) Duplicate the top of the stack.",
+	"V":    "( -- ) Print the whole stack.",
+	"CR":   "( -- ) Print a newline.",
+	"FMT":  "( v1 ... vn format -- ) Print values with a Printf style format string. %[n] picks a value by position.",
+	"DROP": "( a -- ) Discard the top of the stack.",
+	"SWAP": "( a b -- b a ) Swap the top two values.",
+	"OVER": "( a b -- a b a ) Copy the second value to the top.",
+	"ROT":  "( a b c -- b c a ) Rotate the top three values.",
+	"XX":   "( ... -- ) Clear the stack.",
+
+	// Maths
+	"+":   "( a b -- a+b ) Add two ints or join two strings.",
+	"-":   "( a b -- a-b ) Subtract.",
+	"*":   "( a b -- a*b ) Multiply.",
+	"/":   "( a b -- a/b ) Divide, rounding towards zero. Fails if b is 0.",
+	"MOD": "( a b -- a%b ) Remainder after division. Fails if b is 0.",
+
+	// Comparison
+	"=":  "( a b -- bool ) Equal.",
+	"<>": "( a b -- bool ) Not equal.",
+	"<":  "( a b -- bool ) Less than.",
+	">":  "( a b -- bool ) Greater than.",
+	"<=": "( a b -- bool ) Less than or equal.",
+	">=": "( a b -- bool ) Greater than or equal.",
+
+	// Logic
+	"AND": "( a b -- c ) Logical and of bools, bitwise and of ints.",
+	"OR":  "( a b -- c ) Logical or of bools, bitwise or of ints.",
+	"XOR": "( a b -- c ) Logical xor of bools, bitwise xor of ints.",
+	"NOT": "( a -- b ) Logical not of a bool, bitwise not of an int.",
+
+	// Strings
+	"LEN":    "( s|list -- n ) Length of a string or list.",
+	"SUBSTR": "( s start count -- s' ) Part of a string.",
+	"UPPER":  "( s -- S ) Upper case a string.",
+	"LOWER":  "( S -- s ) Lower case a string.",
+	"SPLIT":  "( s sep -- p1 ... pn n ) Split a string, pushing the pieces and how many there are.",
+	">STR":   "( v -- s ) Convert a value to a string.",
+	">NUM":   "( s -- n ) Parse a string as an int.",
+
+	// Lists
+	"[":      "( -- ) Start a list.",
+	"]":      "( v1 ... vn -- list ) Collect everything since the matching [ into a list.",
+	"NTH":    "( list i -- v ) The item at index i of a list.",
+	"APPEND": "( list v -- list' ) Add a value to the end of a list.",
+	"EACH":   "( list quote -- ) Call a quotation with each item of a list.",
+	"MAP":    "( list quote -- list' ) Call a quotation with each item of a list, collecting the results.",
+
+	// Quotations
+	"{":       "( -- quote ) Start a quotation, a block of code that can be called later.",
+	"}":       "End a quotation.",
+	"CALL":    "( quote -- ) Run a quotation.",
+	"EXECUTE": "( quote -- ) Run a quotation.",
+	"TIMES":   "( n quote -- ) Run a quotation n times.",
+
+	// Conditionals
+	"IF":   "( bool -- ) cond IF ... [ELSE ...] THEN runs the first branch if cond is TRUE, otherwise the ELSE branch.",
+	"ELSE": "Start the branch of an IF that runs when the condition is FALSE.",
+	"THEN": "End an IF.",
+	"JMP":  "( -- ) Jump to an address. Used by the compiler for ELSE.",
+
+	// Errors
+	"TRY":    "( -- ) TRY ... CATCH ... ENDTRY runs the CATCH body if the TRY body fails, with the stack as it was at TRY and the error message on top.",
+	"CATCH":  "( -- msg ) Start the handler of a TRY.",
+	"ENDTRY": "End a TRY.",
+	"THROW":  "( v -- ) Raise an error with the value as its message.",
+
+	// Assertions
+	"ASSERT":     "( cond [msg] -- ) Fail unless cond is TRUE.",
+	"ASSERT=":    "( actual expected -- ) Fail unless the two values are the same.",
+	"ASSERT-POS": "( x y f -- ) Fail unless the robot is at x,y facing f.",
+}
@@ -0,0 +1,143 @@
+package toyrobot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/danwhitford/toyrobot/stack"
+)
+
+// ErrStackUnderflow is returned when a word needs more values than are on
+// the stack.
+var ErrStackUnderflow = stack.ErrUnderflow
+
+// ErrUnmatchedList is returned when ] has no [ to go with it.
+var ErrUnmatchedList = errors.New("unmatched ]")
+
+// ErrListUnderflow is returned when the values between [ and ] are dropped
+// before the list is closed.
+var ErrListUnderflow = errors.New("stack shrank below start of list")
+
+// ErrFileOutputDisabled is returned by words that write files when
+// Robot.CreateFile isn't set.
+var ErrFileOutputDisabled = errors.New("writing files is disabled")
+
+// TypeMismatchError is returned when a word is given a value of a type it
+// can't work with.
+type TypeMismatchError struct {
+	Word     string
+	Expected []RobotType
+	Actual   RobotType
+}
+
+func (e *TypeMismatchError) Error() string {
+	expected := make([]string, len(e.Expected))
+	for i, t := range e.Expected {
+		expected[i] = t.String()
+	}
+	return fmt.Sprintf("expected %s for %s, got %s", strings.Join(expected, " or "), e.Word, e.Actual)
+}
+
+// UnknownWordError is returned when a program uses a word that isn't in the
+// robot's dictionary.
+type UnknownWordError struct {
+	Word string
+}
+
+func (e *UnknownWordError) Error() string {
+	return fmt.Sprintf("unknown word '%s'", e.Word)
+}
+
+// CompileError is returned when a program can't be tokenised or compiled.
+type CompileError struct {
+	Pos Position
+	Err error
+}
+
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Err)
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
+
+// ThrownError is returned when a program runs THROW.
+type ThrownError struct {
+	Value RobotValue
+}
+
+func (e *ThrownError) Error() string {
+	return e.Value.String()
+}
+
+// AssertionError is returned when one of the ASSERT words fails.
+type AssertionError struct {
+	Pos    Position
+	HasPos bool
+	Msg    string
+	// Where the robot was when the assertion failed
+	Robot string
+}
+
+func (e *AssertionError) Error() string {
+	where := ""
+	if e.HasPos {
+		where = " at " + e.Pos.String()
+	}
+	return fmt.Sprintf("assertion failed%s: %s (robot %s)", where, e.Msg, e.Robot)
+}
+
+// IndexError is returned when a word is given an index outside a list.
+type IndexError struct {
+	Word   string
+	Index  int
+	Length int
+}
+
+func (e *IndexError) Error() string {
+	return fmt.Sprintf("index %d out of range for list of length %d", e.Index, e.Length)
+}
+
+// RangeError is returned when a word is given a range that doesn't fit in a
+// string.
+type RangeError struct {
+	Word   string
+	Start  int
+	Count  int
+	Length int
+}
+
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("substring %d %d out of range for string of length %d", e.Start, e.Count, e.Length)
+}
+
+// ConversionError is returned when a string can't be converted to a number.
+type ConversionError struct {
+	Word  string
+	Value string
+}
+
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("cannot convert %q to a number", e.Value)
+}
+
+// InvalidFacingError is returned when PLACE is given a direction that isn't
+// one of NORTH, EAST, SOUTH or WEST.
+type InvalidFacingError struct {
+	Facing Direction
+}
+
+func (e *InvalidFacingError) Error() string {
+	return fmt.Sprintf("invalid facing %v", e.Facing)
+}
+
+// DivisionByZeroError is returned when / or MOD is given a divisor of zero.
+type DivisionByZeroError struct {
+	Word string
+}
+
+func (e *DivisionByZeroError) Error() string {
+	return fmt.Sprintf("division by zero in %s", e.Word)
+}
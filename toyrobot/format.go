@@ -0,0 +1,159 @@
+package toyrobot
+
+import (
+	"strings"
+)
+
+// Indent is the indentation for each level of a block in formatted code.
+const Indent = "  "
+
+// Format rewrites a .bot file in the canonical style. Words are upper case
+// and separated by single spaces, line breaks are kept but runs of blank
+// lines are squashed to one, and the bodies of IF, TRY and quotations that
+// span more than one line are indented on lines of their own. Comments and
+// the expected output block are kept as they are.
+func Format(content string) (string, error) {
+	program, output := content, ""
+	if i := strings.Index(content, GoldenMarker); i >= 0 {
+		program, output = content[:i], content[i:]
+	}
+
+	tokeniser := RobotTokeniser{}
+	tokens, err := tokeniser.Tokenise(program)
+	if err != nil {
+		return "", err
+	}
+	nodes, err := (&RobotParser{}).Parse(tokens)
+	if err != nil {
+		return "", err
+	}
+
+	p := printer{comments: tokeniser.Comments}
+	p.nodes(nodes)
+	p.commentsBefore(Position{Line: int(^uint(0) >> 1)})
+	p.flush()
+	return p.out.String() + output, nil
+}
+
+// printer lays out tokens a line at a time, following the line breaks in
+// the source.
+type printer struct {
+	out      strings.Builder
+	line     []string
+	indent   int
+	comments []Comment
+
+	// The source line of the last thing printed
+	lastLine int
+}
+
+func (p *printer) nodes(nodes []Node) {
+	for _, node := range nodes {
+		p.node(node)
+	}
+}
+
+func (p *printer) node(node Node) {
+	switch n := node.(type) {
+	case *Literal:
+		p.token(n.Token)
+	case *WordCall:
+		p.token(n.Token)
+	case *Conditional:
+		multi := n.If.Pos.Line != n.End.Pos.Line
+		p.token(n.If)
+		if n.ElseToken != nil {
+			p.block(n.Then, multi, *n.ElseToken)
+			p.token(*n.ElseToken)
+			p.block(n.Else, multi, n.End)
+		} else {
+			p.block(n.Then, multi, n.End)
+		}
+		p.token(n.End)
+	case *TryCatch:
+		multi := n.Try.Pos.Line != n.End.Pos.Line
+		p.token(n.Try)
+		p.block(n.Body, multi, n.Catch)
+		p.token(n.Catch)
+		p.block(n.Handler, multi, n.End)
+		p.token(n.End)
+	case *QuotationNode:
+		multi := n.Open.Pos.Line != n.Close.Pos.Line
+		p.token(n.Open)
+		p.block(n.Body, multi, n.Close)
+		p.token(n.Close)
+	}
+}
+
+// block prints the body of an IF, TRY or quotation, indented on lines of its
+// own if multi is set. end is the token that closes the body.
+func (p *printer) block(nodes []Node, multi bool, end Token) {
+	if !multi {
+		p.nodes(nodes)
+		return
+	}
+	p.flush()
+	p.indent++
+	p.nodes(nodes)
+	p.commentsBefore(end.Pos)
+	p.flush()
+	p.indent--
+}
+
+func (p *printer) token(token Token) {
+	p.commentsBefore(token.Pos)
+	p.startLine(token.Pos.Line)
+	p.line = append(p.line, tokenText(token))
+	p.lastLine = token.Pos.Line
+}
+
+// startLine starts a new line if something from source line line shouldn't
+// go on the current one.
+func (p *printer) startLine(line int) {
+	if len(p.line) > 0 && line == p.lastLine {
+		return
+	}
+	p.flush()
+	if p.out.Len() > 0 && line > p.lastLine+1 {
+		p.out.WriteString("\n")
+	}
+}
+
+// commentsBefore prints the comments that come before pos. A comment on the
+// same line as the code before it stays on that line.
+func (p *printer) commentsBefore(pos Position) {
+	for len(p.comments) > 0 {
+		c := p.comments[0]
+		if c.Pos.Line > pos.Line || c.Pos.Line == pos.Line && c.Pos.Col > pos.Col {
+			return
+		}
+		p.comments = p.comments[1:]
+		p.startLine(c.Pos.Line)
+		p.line = append(p.line, c.Text)
+		p.lastLine = c.Pos.Line
+		p.flush()
+	}
+}
+
+// flush writes out the current line.
+func (p *printer) flush() {
+	if len(p.line) == 0 {
+		return
+	}
+	p.out.WriteString(strings.Repeat(Indent, p.indent))
+	p.out.WriteString(strings.Join(p.line, " "))
+	p.out.WriteString("\n")
+	p.line = p.line[:0]
+}
+
+// tokenText is how a token is written in formatted code.
+func tokenText(token Token) string {
+	switch token.Type {
+	case TOKEN_WORD:
+		return token.Value.(string)
+	case TOKEN_STRING, TOKEN_NUMBER:
+		return token.Lexeme
+	default:
+		return strings.ToUpper(token.Lexeme)
+	}
+}
@@ -0,0 +1,98 @@
+package toyrobot
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFormat(t *testing.T) {
+	table := []struct {
+		input, want string
+	}{
+		{"move   left\n", "MOVE LEFT\n"},
+		{"place 0 0 north true drop", "PLACE 0 0 NORTH TRUE DROP\n"},
+		{"\"a\\tb\"   .", "\"a\\tb\" .\n"},
+		{"1\n\n\n\n2\n\n", "1\n\n2\n"},
+		{"TRUE if 1 else 2 then", "TRUE IF 1 ELSE 2 THEN\n"},
+		{
+			"TRUE if 1\n2 else\n3 then .",
+			"TRUE IF\n  1\n  2\nELSE\n  3\nTHEN .\n",
+		},
+		{
+			"try\n    { left\nmove } call\ncatch . endtry",
+			"TRY\n  {\n    LEFT\n    MOVE\n  } CALL\nCATCH\n  .\nENDTRY\n",
+		},
+		{
+			"# heading\nmove   # go\nIF\n  # inside\nTHEN\n# the end",
+			"# heading\nMOVE # go\nIF\n  # inside\nTHEN\n# the end\n",
+		},
+		{
+			"1   .\n### OUTPUT ###\n# 1\n#   spaced\n",
+			"1 .\n### OUTPUT ###\n# 1\n#   spaced\n",
+		},
+	}
+
+	for _, tst := range table {
+		got, err := Format(tst.input)
+		if err != nil {
+			t.Errorf("Format(%q) error: %s", tst.input, err)
+			continue
+		}
+		if diff := cmp.Diff(tst.want, got); diff != "" {
+			t.Errorf("Format(%q) mismatch (-want +got):\n%s", tst.input, diff)
+		}
+	}
+}
+
+func TestFormat_Error(t *testing.T) {
+	_, err := Format("1 IF 2")
+	if err == nil || err.Error() != "1:3: IF without THEN" {
+		t.Errorf("Format error = %v, want 1:3: IF without THEN", err)
+	}
+}
+
+// Formatting the test programs shouldn't change what they compile to, and
+// formatting them again shouldn't change them.
+func TestFormatPrograms(t *testing.T) {
+	testEnts, err := programs.ReadDir("programs")
+	if err != nil {
+		t.Fatalf("Error reading test programs: %s", err)
+	}
+
+	for _, testEnt := range testEnts {
+		name := fmt.Sprintf("programs/%s", testEnt.Name())
+		contentBytes, err := programs.ReadFile(name)
+		if err != nil {
+			t.Fatalf("Error reading test program %s: %s", testEnt.Name(), err)
+		}
+		formatted, err := Format(string(contentBytes))
+		if err != nil {
+			t.Fatalf("Error formatting %s: %s", testEnt.Name(), err)
+		}
+		again, err := Format(formatted)
+		if err != nil {
+			t.Fatalf("Error formatting %s again: %s", testEnt.Name(), err)
+		}
+		if diff := cmp.Diff(formatted, again); diff != "" {
+			t.Errorf("Formatting %s isn't stable (-first +second):\n%s", testEnt.Name(), diff)
+		}
+
+		compiler := RobotCompiler{}
+		program, _, _ := SplitGolden(string(contentBytes))
+		want, err := compile(&compiler, program)
+		if err != nil {
+			t.Fatalf("Error compiling %s: %s", testEnt.Name(), err)
+		}
+		program, _, _ = SplitGolden(formatted)
+		got, err := compile(&compiler, program)
+		if err != nil {
+			t.Fatalf("Error compiling formatted %s: %s", testEnt.Name(), err)
+		}
+		if !bytes.Equal(want, got) {
+			t.Errorf("Formatted %s compiles differently", testEnt.Name())
+		}
+	}
+}
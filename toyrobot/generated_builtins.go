@@ -1,7 +1,5 @@
 package toyrobot
 
-import "fmt"
-
 func (r *Robot) mul() error {
 	a, err := r.RobotValueStack.Pop()
 	if err != nil {
@@ -12,13 +10,13 @@ func (r *Robot) mul() error {
 		return err
 	}
 	if a.Type != b.Type {
-		return fmt.Errorf("types do not match")
+		return &TypeMismatchError{Word: "*", Expected: []RobotType{b.Type}, Actual: a.Type}
 	}
 	switch a.Type {
 	case T_INT:
 		r.RobotValueStack.Push(RobotValue{Type: T_INT, Value: b.Value.(int) * a.Value.(int)})
 	default:
-		return fmt.Errorf("unsupported type")
+		return &TypeMismatchError{Word: "*", Expected: []RobotType{T_INT}, Actual: a.Type}
 	}
 	return nil
 }
@@ -33,13 +31,20 @@ func (r *Robot) add() error {
 		return err
 	}
 	if a.Type != b.Type {
-		return fmt.Errorf("types do not match")
+		return &TypeMismatchError{Word: "+", Expected: []RobotType{b.Type}, Actual: a.Type}
 	}
 	switch a.Type {
 	case T_INT:
 		r.RobotValueStack.Push(RobotValue{Type: T_INT, Value: b.Value.(int) + a.Value.(int)})
+	case T_STRING:
+		v := RobotValue{Type: T_STRING, Value: b.Value.(string) + a.Value.(string)}
+		err := r.checkSize(v)
+		if err != nil {
+			return err
+		}
+		r.RobotValueStack.Push(v)
 	default:
-		return fmt.Errorf("unsupported type")
+		return &TypeMismatchError{Word: "+", Expected: []RobotType{T_INT, T_STRING}, Actual: a.Type}
 	}
 	return nil
 }
@@ -54,13 +59,13 @@ func (r *Robot) sub() error {
 		return err
 	}
 	if a.Type != b.Type {
-		return fmt.Errorf("types do not match")
+		return &TypeMismatchError{Word: "-", Expected: []RobotType{b.Type}, Actual: a.Type}
 	}
 	switch a.Type {
 	case T_INT:
 		r.RobotValueStack.Push(RobotValue{Type: T_INT, Value: b.Value.(int) - a.Value.(int)})
 	default:
-		return fmt.Errorf("unsupported type")
+		return &TypeMismatchError{Word: "-", Expected: []RobotType{T_INT}, Actual: a.Type}
 	}
 	return nil
 }
@@ -75,13 +80,16 @@ func (r *Robot) div() error {
 		return err
 	}
 	if a.Type != b.Type {
-		return fmt.Errorf("types do not match")
+		return &TypeMismatchError{Word: "/", Expected: []RobotType{b.Type}, Actual: a.Type}
 	}
 	switch a.Type {
 	case T_INT:
+		if a.Value.(int) == 0 {
+			return &DivisionByZeroError{Word: "/"}
+		}
 		r.RobotValueStack.Push(RobotValue{Type: T_INT, Value: b.Value.(int) / a.Value.(int)})
 	default:
-		return fmt.Errorf("unsupported type")
+		return &TypeMismatchError{Word: "/", Expected: []RobotType{T_INT}, Actual: a.Type}
 	}
 	return nil
 }
@@ -96,13 +104,16 @@ func (r *Robot) mod() error {
 		return err
 	}
 	if a.Type != b.Type {
-		return fmt.Errorf("types do not match")
+		return &TypeMismatchError{Word: "MOD", Expected: []RobotType{b.Type}, Actual: a.Type}
 	}
 	switch a.Type {
 	case T_INT:
+		if a.Value.(int) == 0 {
+			return &DivisionByZeroError{Word: "MOD"}
+		}
 		r.RobotValueStack.Push(RobotValue{Type: T_INT, Value: b.Value.(int) % a.Value.(int)})
 	default:
-		return fmt.Errorf("unsupported type")
+		return &TypeMismatchError{Word: "MOD", Expected: []RobotType{T_INT}, Actual: a.Type}
 	}
 	return nil
 }
@@ -117,13 +128,15 @@ func (r *Robot) eq() error {
 		return err
 	}
 	if a.Type != b.Type {
-		return fmt.Errorf("types do not match")
+		return &TypeMismatchError{Word: "=", Expected: []RobotType{b.Type}, Actual: a.Type}
 	}
 	switch a.Type {
 	case T_INT:
 		r.RobotValueStack.Push(RobotValue{Type: T_BOOL, Value: b.Value.(int) == a.Value.(int)})
+	case T_STRING:
+		r.RobotValueStack.Push(RobotValue{Type: T_BOOL, Value: b.Value.(string) == a.Value.(string)})
 	default:
-		return fmt.Errorf("unsupported type")
+		return &TypeMismatchError{Word: "=", Expected: []RobotType{T_INT, T_STRING}, Actual: a.Type}
 	}
 	return nil
 }
@@ -138,13 +151,15 @@ func (r *Robot) neq() error {
 		return err
 	}
 	if a.Type != b.Type {
-		return fmt.Errorf("types do not match")
+		return &TypeMismatchError{Word: "<>", Expected: []RobotType{b.Type}, Actual: a.Type}
 	}
 	switch a.Type {
 	case T_INT:
 		r.RobotValueStack.Push(RobotValue{Type: T_BOOL, Value: b.Value.(int) != a.Value.(int)})
+	case T_STRING:
+		r.RobotValueStack.Push(RobotValue{Type: T_BOOL, Value: b.Value.(string) != a.Value.(string)})
 	default:
-		return fmt.Errorf("unsupported type")
+		return &TypeMismatchError{Word: "<>", Expected: []RobotType{T_INT, T_STRING}, Actual: a.Type}
 	}
 	return nil
 }
@@ -159,13 +174,13 @@ func (r *Robot) lt() error {
 		return err
 	}
 	if a.Type != b.Type {
-		return fmt.Errorf("types do not match")
+		return &TypeMismatchError{Word: "<", Expected: []RobotType{b.Type}, Actual: a.Type}
 	}
 	switch a.Type {
 	case T_INT:
 		r.RobotValueStack.Push(RobotValue{Type: T_BOOL, Value: b.Value.(int) < a.Value.(int)})
 	default:
-		return fmt.Errorf("unsupported type")
+		return &TypeMismatchError{Word: "<", Expected: []RobotType{T_INT}, Actual: a.Type}
 	}
 	return nil
 }
@@ -180,13 +195,13 @@ func (r *Robot) gt() error {
 		return err
 	}
 	if a.Type != b.Type {
-		return fmt.Errorf("types do not match")
+		return &TypeMismatchError{Word: ">", Expected: []RobotType{b.Type}, Actual: a.Type}
 	}
 	switch a.Type {
 	case T_INT:
 		r.RobotValueStack.Push(RobotValue{Type: T_BOOL, Value: b.Value.(int) > a.Value.(int)})
 	default:
-		return fmt.Errorf("unsupported type")
+		return &TypeMismatchError{Word: ">", Expected: []RobotType{T_INT}, Actual: a.Type}
 	}
 	return nil
 }
@@ -201,13 +216,13 @@ func (r *Robot) lte() error {
 		return err
 	}
 	if a.Type != b.Type {
-		return fmt.Errorf("types do not match")
+		return &TypeMismatchError{Word: "<=", Expected: []RobotType{b.Type}, Actual: a.Type}
 	}
 	switch a.Type {
 	case T_INT:
 		r.RobotValueStack.Push(RobotValue{Type: T_BOOL, Value: b.Value.(int) <= a.Value.(int)})
 	default:
-		return fmt.Errorf("unsupported type")
+		return &TypeMismatchError{Word: "<=", Expected: []RobotType{T_INT}, Actual: a.Type}
 	}
 	return nil
 }
@@ -222,13 +237,98 @@ func (r *Robot) gte() error {
 		return err
 	}
 	if a.Type != b.Type {
-		return fmt.Errorf("types do not match")
+		return &TypeMismatchError{Word: ">=", Expected: []RobotType{b.Type}, Actual: a.Type}
 	}
 	switch a.Type {
 	case T_INT:
 		r.RobotValueStack.Push(RobotValue{Type: T_BOOL, Value: b.Value.(int) >= a.Value.(int)})
 	default:
-		return fmt.Errorf("unsupported type")
+		return &TypeMismatchError{Word: ">=", Expected: []RobotType{T_INT}, Actual: a.Type}
+	}
+	return nil
+}
+
+func (r *Robot) and() error {
+	a, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
+	}
+	b, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
+	}
+	if a.Type != b.Type {
+		return &TypeMismatchError{Word: "AND", Expected: []RobotType{b.Type}, Actual: a.Type}
+	}
+	switch a.Type {
+	case T_BOOL:
+		r.RobotValueStack.Push(RobotValue{Type: T_BOOL, Value: b.Value.(bool) && a.Value.(bool)})
+	case T_INT:
+		r.RobotValueStack.Push(RobotValue{Type: T_INT, Value: b.Value.(int) & a.Value.(int)})
+	default:
+		return &TypeMismatchError{Word: "AND", Expected: []RobotType{T_BOOL, T_INT}, Actual: a.Type}
+	}
+	return nil
+}
+
+func (r *Robot) or() error {
+	a, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
+	}
+	b, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
+	}
+	if a.Type != b.Type {
+		return &TypeMismatchError{Word: "OR", Expected: []RobotType{b.Type}, Actual: a.Type}
+	}
+	switch a.Type {
+	case T_BOOL:
+		r.RobotValueStack.Push(RobotValue{Type: T_BOOL, Value: b.Value.(bool) || a.Value.(bool)})
+	case T_INT:
+		r.RobotValueStack.Push(RobotValue{Type: T_INT, Value: b.Value.(int) | a.Value.(int)})
+	default:
+		return &TypeMismatchError{Word: "OR", Expected: []RobotType{T_BOOL, T_INT}, Actual: a.Type}
+	}
+	return nil
+}
+
+func (r *Robot) xor() error {
+	a, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
+	}
+	b, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
+	}
+	if a.Type != b.Type {
+		return &TypeMismatchError{Word: "XOR", Expected: []RobotType{b.Type}, Actual: a.Type}
+	}
+	switch a.Type {
+	case T_BOOL:
+		r.RobotValueStack.Push(RobotValue{Type: T_BOOL, Value: b.Value.(bool) != a.Value.(bool)})
+	case T_INT:
+		r.RobotValueStack.Push(RobotValue{Type: T_INT, Value: b.Value.(int) ^ a.Value.(int)})
+	default:
+		return &TypeMismatchError{Word: "XOR", Expected: []RobotType{T_BOOL, T_INT}, Actual: a.Type}
+	}
+	return nil
+}
+
+func (r *Robot) not() error {
+	a, err := r.RobotValueStack.Pop()
+	if err != nil {
+		return err
+	}
+	switch a.Type {
+	case T_BOOL:
+		r.RobotValueStack.Push(RobotValue{Type: T_BOOL, Value: !a.Value.(bool)})
+	case T_INT:
+		r.RobotValueStack.Push(RobotValue{Type: T_INT, Value: ^a.Value.(int)})
+	default:
+		return &TypeMismatchError{Word: "NOT", Expected: []RobotType{T_BOOL, T_INT}, Actual: a.Type}
 	}
 	return nil
 }
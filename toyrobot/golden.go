@@ -0,0 +1,60 @@
+package toyrobot
+
+import (
+	"bytes"
+	"strings"
+)
+
+// GoldenMarker separates a program from the output it is expected to
+// produce. Each line of expected output follows it as a `# ` comment.
+const GoldenMarker = "### OUTPUT ###\n"
+
+// SplitGolden splits a .bot file into its program and expected output.
+// ok is false if the file has no expected output block.
+func SplitGolden(content string) (program, expected string, ok bool) {
+	parts := strings.SplitN(content, GoldenMarker, 2)
+	if len(parts) < 2 {
+		return content, "", false
+	}
+	var outputSB strings.Builder
+	for _, line := range strings.Split(parts[1], "\n") {
+		line = strings.TrimPrefix(line, "# ")
+		outputSB.WriteString(line)
+		outputSB.WriteString("\n")
+	}
+	return parts[0], outputSB.String(), true
+}
+
+// UpdateGolden replaces the expected output block in a .bot file with
+// output, adding the block if there wasn't one.
+func UpdateGolden(content, output string) string {
+	program, _, ok := SplitGolden(content)
+	var sb strings.Builder
+	sb.WriteString(program)
+	if !ok && !strings.HasSuffix(program, "\n") {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(GoldenMarker)
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		sb.WriteString("# ")
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// GoldenLines normalises output for comparison against a golden block.
+func GoldenLines(output string) []string {
+	return strings.Split(strings.TrimSpace(output), "\n")
+}
+
+// RunGolden runs a .bot file's program on a fresh robot and returns what it
+// printed along with the output it was expected to print.
+func RunGolden(content string) (got, want string, ok bool, err error) {
+	program, want, ok := SplitGolden(content)
+	var buffer bytes.Buffer
+	robot := NewRobot()
+	robot.Output = &buffer
+	err = robot.RunProgram(program)
+	return buffer.String(), want, ok, err
+}
@@ -0,0 +1,137 @@
+package toyrobot
+
+import (
+	"context"
+	"fmt"
+)
+
+// InstructionLimitError is returned when a program runs more instructions
+// than Robot.MaxInstructions allows.
+type InstructionLimitError struct {
+	Limit int
+}
+
+func (e *InstructionLimitError) Error() string {
+	return fmt.Sprintf("instruction limit of %d reached", e.Limit)
+}
+
+// StackLimitError is returned when a program grows the value stack past
+// Robot.MaxStackDepth.
+type StackLimitError struct {
+	Limit int
+}
+
+func (e *StackLimitError) Error() string {
+	return fmt.Sprintf("stack depth limit of %d reached", e.Limit)
+}
+
+// ValueLimitError is returned when a program makes a string or list bigger
+// than Robot.MaxValueSize allows.
+type ValueLimitError struct {
+	Limit int
+}
+
+func (e *ValueLimitError) Error() string {
+	return fmt.Sprintf("value size limit of %d reached", e.Limit)
+}
+
+// CancelledError is returned when the context a program is running under is
+// cancelled or times out. It unwraps to the context's error.
+type CancelledError struct {
+	Err error
+}
+
+func (e *CancelledError) Error() string {
+	return fmt.Sprintf("program stopped: %s", e.Err)
+}
+
+func (e *CancelledError) Unwrap() error {
+	return e.Err
+}
+
+// Limit errors can't be caught by TRY, otherwise a program could carry on
+// past them.
+func (e *InstructionLimitError) uncatchable() {}
+func (e *StackLimitError) uncatchable()       {}
+func (e *ValueLimitError) uncatchable()       {}
+func (e *CancelledError) uncatchable()        {}
+
+type uncatchable interface {
+	uncatchable()
+}
+
+// checkLimits is called before each instruction is run and each quotation
+// is called.
+func (r *Robot) checkLimits() error {
+	if r.ctx != nil {
+		select {
+		case <-r.ctx.Done():
+			return &CancelledError{Err: r.ctx.Err()}
+		default:
+		}
+	}
+	if r.MaxInstructions > 0 && r.executed >= r.MaxInstructions {
+		return &InstructionLimitError{Limit: r.MaxInstructions}
+	}
+	r.executed++
+	return nil
+}
+
+// checkStack is called after each instruction is run, so that the stack
+// can't end a program, or a word that pushes many values, past its limit.
+func (r *Robot) checkStack() error {
+	if r.MaxStackDepth > 0 && len(*r.RobotValueStack) > r.MaxStackDepth {
+		return &StackLimitError{Limit: r.MaxStackDepth}
+	}
+	return nil
+}
+
+// checkSize is called on each string and list a word makes, before it is
+// pushed.
+func (r *Robot) checkSize(v RobotValue) error {
+	if r.MaxValueSize > 0 && valueSize(v, r.MaxValueSize) > r.MaxValueSize {
+		return &ValueLimitError{Limit: r.MaxValueSize}
+	}
+	return nil
+}
+
+// pushSized pushes a string or list a word has made, unless it is too big.
+func (r *Robot) pushSized(v RobotValue) error {
+	err := r.checkSize(v)
+	if err != nil {
+		return err
+	}
+	r.RobotValueStack.Push(v)
+	return nil
+}
+
+// valueSize is roughly how many bytes v takes up when printed. It stops
+// counting once past limit, as a list can hold the same list many times
+// over and be far bigger printed than it is in memory.
+func valueSize(v RobotValue, limit int) int {
+	switch v.Type {
+	case T_STRING:
+		return len(v.Value.(string))
+	case T_QUOTE:
+		return len(v.Value.(Quotation).Source) + 4
+	case T_LIST:
+		size := 3
+		for _, el := range v.Value.([]RobotValue) {
+			size += valueSize(el, limit-size) + 1
+			if size > limit {
+				break
+			}
+		}
+		return size
+	default:
+		return 1
+	}
+}
+
+// RunProgramContext runs a program like RunProgram, stopping early if ctx is
+// cancelled.
+func (r *Robot) RunProgramContext(ctx context.Context, program string) error {
+	r.ctx = ctx
+	defer func() { r.ctx = nil }()
+	return r.RunProgram(program)
+}
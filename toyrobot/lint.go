@@ -0,0 +1,149 @@
+package toyrobot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Finding is a problem the linter found in a program.
+type Finding struct {
+	Pos     Position
+	Rule    string
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Pos, f.Rule, f.Message)
+}
+
+// Lint rules
+const (
+	// The program doesn't tokenise or parse
+	RULE_SYNTAX = "syntax"
+	// A word that isn't in the robot's dictionary
+	RULE_UNKNOWN_WORD = "unknown-word"
+	// MOVE, LEFT or RIGHT before there's any PLACE, which does nothing. A
+	// PLACE in an IF, TRY or quotation only counts for the rest of that
+	// block, as it might not run.
+	RULE_MOVE_BEFORE_PLACE = "move-before-place"
+	// PLACE with literal coordinates that are off the board
+	RULE_PLACE_OFF_BOARD = "place-off-board"
+	// A branch of an IF on a literal TRUE or FALSE that can never run
+	RULE_UNREACHABLE = "unreachable"
+)
+
+// Lint checks a program for likely mistakes without running it.
+func (r *Robot) Lint(program string) []Finding {
+	tokens, err := (&RobotTokeniser{}).Tokenise(program)
+	if err == nil {
+		var nodes []Node
+		nodes, err = (&RobotParser{}).Parse(tokens)
+		if err == nil {
+			l := linter{robot: r}
+			l.block(nodes, false)
+			sort.SliceStable(l.findings, func(i, j int) bool {
+				a, b := l.findings[i].Pos, l.findings[j].Pos
+				return a.Line < b.Line || a.Line == b.Line && a.Col < b.Col
+			})
+			return l.findings
+		}
+	}
+
+	var compileErr *CompileError
+	if errors.As(err, &compileErr) {
+		return []Finding{{Pos: compileErr.Pos, Rule: RULE_SYNTAX, Message: compileErr.Err.Error()}}
+	}
+	return []Finding{{Pos: Position{1, 1}, Rule: RULE_SYNTAX, Message: err.Error()}}
+}
+
+type linter struct {
+	robot    *Robot
+	placed   bool
+	findings []Finding
+}
+
+func (l *linter) report(pos Position, rule, format string, a ...any) {
+	l.findings = append(l.findings, Finding{Pos: pos, Rule: rule, Message: fmt.Sprintf(format, a...)})
+}
+
+// block checks a list of nodes. quoted is set inside quotations, which run
+// whenever they're called rather than where they're written.
+func (l *linter) block(nodes []Node, quoted bool) {
+	for i, node := range nodes {
+		switch n := node.(type) {
+		case *WordCall:
+			l.word(nodes[:i], n, quoted)
+		case *Conditional:
+			l.conditional(nodes[:i], n)
+			l.nested(n.Then, quoted)
+			l.nested(n.Else, quoted)
+		case *TryCatch:
+			l.nested(n.Body, quoted)
+			l.nested(n.Handler, quoted)
+		case *QuotationNode:
+			l.nested(n.Body, true)
+		}
+	}
+}
+
+// nested checks a block that might not run, so a PLACE inside it doesn't
+// count once it's finished.
+func (l *linter) nested(nodes []Node, quoted bool) {
+	placed := l.placed
+	l.block(nodes, quoted)
+	l.placed = placed
+}
+
+// word checks a word call, where before are the nodes before it in the same
+// block.
+func (l *linter) word(before []Node, n *WordCall, quoted bool) {
+	word := n.Word()
+	if _, ok := l.robot.Dictionary[word]; !ok {
+		l.report(n.Pos(), RULE_UNKNOWN_WORD, "unknown word '%s'", word)
+	}
+
+	switch word {
+	case "PLACE":
+		l.placed = true
+		if len(before) < 3 {
+			return
+		}
+		x, xok := intLiteral(before[len(before)-3])
+		y, yok := intLiteral(before[len(before)-2])
+		if xok && yok && !onBoard(x, y) {
+			l.report(n.Pos(), RULE_PLACE_OFF_BOARD, "%d,%d is off the %dx%d board so PLACE does nothing", x, y, BoardSize, BoardSize)
+		}
+	case "MOVE", "LEFT", "RIGHT":
+		if !l.placed && !quoted {
+			l.report(n.Pos(), RULE_MOVE_BEFORE_PLACE, "%s before PLACE does nothing", word)
+		}
+	}
+}
+
+// conditional checks for branches that can't run because the condition is
+// a literal.
+func (l *linter) conditional(before []Node, n *Conditional) {
+	if len(before) == 0 {
+		return
+	}
+	lit, ok := before[len(before)-1].(*Literal)
+	if !ok || lit.Token.Type != TOKEN_BOOL {
+		return
+	}
+	if lit.Token.Value.(bool) {
+		if len(n.Else) > 0 {
+			l.report(n.Else[0].Pos(), RULE_UNREACHABLE, "ELSE branch never runs as the condition is always TRUE")
+		}
+	} else if len(n.Then) > 0 {
+		l.report(n.Then[0].Pos(), RULE_UNREACHABLE, "IF branch never runs as the condition is always FALSE")
+	}
+}
+
+func intLiteral(node Node) (int, bool) {
+	lit, ok := node.(*Literal)
+	if !ok || lit.Token.Type != TOKEN_NUMBER {
+		return 0, false
+	}
+	return lit.Token.Value.(int), true
+}
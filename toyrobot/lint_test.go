@@ -0,0 +1,60 @@
+package toyrobot
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLint(t *testing.T) {
+	table := []struct {
+		input string
+		want  []string
+	}{
+		{"0 0 NORTH PLACE MOVE REPORT", nil},
+		{"1 IF 2", []string{"1:3: syntax: IF without THEN"}},
+		{"\"open", []string{"1:1: syntax: unterminated string"}},
+		{"1 2 FROB .", []string{"1:5: unknown-word: unknown word 'FROB'"}},
+		{
+			"MOVE LEFT\n0 0 NORTH PLACE RIGHT",
+			[]string{
+				"1:1: move-before-place: MOVE before PLACE does nothing",
+				"1:6: move-before-place: LEFT before PLACE does nothing",
+			},
+		},
+		{"{ MOVE } 0 0 NORTH PLACE CALL", nil},
+		{"DUP IF 0 0 NORTH PLACE MOVE THEN", nil},
+		{
+			"DUP IF 0 0 NORTH PLACE THEN MOVE",
+			[]string{"1:29: move-before-place: MOVE before PLACE does nothing"},
+		},
+		{
+			"{ 0 0 NORTH PLACE } DROP TRY 0 0 NORTH PLACE CATCH ENDTRY LEFT",
+			[]string{"1:59: move-before-place: LEFT before PLACE does nothing"},
+		},
+		{
+			"0 5 NORTH PLACE 5 0 EAST PLACE 4 4 WEST PLACE",
+			[]string{
+				"1:11: place-off-board: 0,5 is off the 5x5 board so PLACE does nothing",
+				"1:26: place-off-board: 5,0 is off the 5x5 board so PLACE does nothing",
+			},
+		},
+		{
+			"FALSE IF 0 THEN TRUE IF 1 ELSE 2 THEN TRUE IF 3 THEN",
+			[]string{
+				"1:10: unreachable: IF branch never runs as the condition is always FALSE",
+				"1:32: unreachable: ELSE branch never runs as the condition is always TRUE",
+			},
+		},
+	}
+
+	for _, tst := range table {
+		var got []string
+		for _, finding := range NewRobot().Lint(tst.input) {
+			got = append(got, finding.String())
+		}
+		if diff := cmp.Diff(tst.want, got); diff != "" {
+			t.Errorf("Lint(%q) mismatch (-want +got):\n%s", tst.input, diff)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package toyrobot
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Words that only look at their arguments, so can be run at compile time
+// when the arguments are literals.
+var foldable = map[string]int{
+	"+": 2, "-": 2, "*": 2, "/": 2, "MOD": 2,
+	"=": 2, "<>": 2, "<": 2, ">": 2, "<=": 2, ">=": 2,
+	"AND": 2, "OR": 2, "XOR": 2, "NOT": 1,
+}
+
+// Words followed by a jump address.
+var jumpWords = map[string]bool{
+	"IF": true, "JMP": true, "TRY": true, "CATCH": true,
+}
+
+// op is a decoded instruction. Jump addresses are held as the index of the
+// op they point at so that ops can be added and removed.
+type op struct {
+	Op     Instruction
+	Value  RobotValue
+	Word   string
+	Target int
+	Pos    Position
+	HasPos bool
+
+	// The ops of a quotation
+	quote []op
+}
+
+func (o op) isWord(word string) bool {
+	return o.Op == OP_EXEC_WORD && o.Word == word
+}
+
+func (o op) isLiteral() bool {
+	return o.Op == OP_PUSH_VAL && o.Value.Type != T_QUOTE
+}
+
+// Optimise rewrites code produced by Compile so that it does less work when
+// run. Arithmetic and comparisons on literals are worked out up front, values
+// pushed only to be dropped are removed and branches on literal booleans are
+// resolved. DUP DROP and SWAP SWAP are removed only straight after enough
+// literals, as elsewhere the stack may be too short for them and the
+// program has to fail the same way it would unoptimised. SourceMap is
+// updated to match the new code.
+//
+// Folding uses the builtin definitions of the words, so code that is run
+// with a changed Dictionary shouldn't be optimised.
+func (r *RobotCompiler) Optimise(code []byte) ([]byte, error) {
+	ops, err := r.decodeOps(code, 0)
+	if err != nil {
+		return nil, err
+	}
+	o := optimiser{scratch: NewRobot()}
+	o.scratch.Output = io.Discard
+	ops = o.optimise(ops)
+
+	sourceMap := make(map[int]Position)
+	code, err = r.encodeOps(ops, 0, sourceMap)
+	if err != nil {
+		return nil, err
+	}
+	r.SourceMap = sourceMap
+	return code, nil
+}
+
+// decodeOps splits a block of code that starts at offset base into ops.
+func (r *RobotCompiler) decodeOps(code []byte, base int) ([]op, error) {
+	ops := make([]op, 0)
+	index := make(map[int]int)
+	addr := func(i int) (int, error) {
+		if i+2 > len(code) {
+			return 0, fmt.Errorf("truncated instruction at %d", i)
+		}
+		return int(code[i])<<8 | int(code[i+1]), nil
+	}
+	for i := 0; i < len(code); {
+		index[i] = len(ops)
+		o := op{Op: Instruction(code[i]), Target: -1}
+		o.Pos, o.HasPos = r.SourceMap[base+i]
+		start := i
+		i++
+		if i >= len(code) {
+			return nil, fmt.Errorf("truncated instruction at %d", start)
+		}
+		switch o.Op {
+		case OP_PUSH_VAL:
+			t := RobotType(code[i])
+			i++
+			switch t {
+			case T_INT:
+				v, n := binary.Varint(code[i:])
+				if n <= 0 {
+					return nil, fmt.Errorf("bad int at %d", start)
+				}
+				o.Value = RobotValue{Type: t, Value: int(v)}
+				i += n
+			case T_DIRECTION, T_BOOL:
+				if i >= len(code) {
+					return nil, fmt.Errorf("truncated instruction at %d", start)
+				}
+				if t == T_BOOL {
+					o.Value = RobotValue{Type: t, Value: code[i] != 0}
+				} else {
+					o.Value = RobotValue{Type: t, Value: Direction(code[i])}
+				}
+				i++
+			case T_STRING:
+				end := i
+				for end < len(code) && code[end] != 0 {
+					end++
+				}
+				if end >= len(code) {
+					return nil, fmt.Errorf("unterminated string at %d", start)
+				}
+				o.Value = RobotValue{Type: t, Value: string(code[i:end])}
+				i = end + 1
+			case T_QUOTE:
+				n, err := addr(i)
+				if err != nil {
+					return nil, err
+				}
+				i += 2
+				if i+n > len(code) {
+					return nil, fmt.Errorf("truncated quotation at %d", start)
+				}
+				o.quote, err = r.decodeOps(code[i:i+n], base+i)
+				if err != nil {
+					return nil, err
+				}
+				i += n
+				end := i
+				for end < len(code) && code[end] != 0 {
+					end++
+				}
+				if end >= len(code) {
+					return nil, fmt.Errorf("unterminated quotation source at %d", start)
+				}
+				o.Value = RobotValue{Type: t, Value: Quotation{Source: string(code[i:end])}}
+				i = end + 1
+			default:
+				return nil, fmt.Errorf("invalid type %s", t)
+			}
+		case OP_EXEC_WORD:
+			w, err := addr(i)
+			if err != nil {
+				return nil, err
+			}
+			i += 2
+			o.Word = r.Words.Name(w)
+			if jumpWords[o.Word] {
+				o.Target, err = addr(i)
+				if err != nil {
+					return nil, err
+				}
+				i += 2
+			}
+		default:
+			return nil, fmt.Errorf("invalid instruction %v", o.Op)
+		}
+		ops = append(ops, o)
+	}
+	index[len(code)] = len(ops)
+
+	for i := range ops {
+		if ops[i].Target < 0 {
+			continue
+		}
+		target, ok := index[ops[i].Target]
+		if !ok {
+			return nil, fmt.Errorf("jump into the middle of an instruction")
+		}
+		ops[i].Target = target
+	}
+	return ops, nil
+}
+
+// encodeOps turns ops back into code that will start at offset base,
+// filling in sourceMap as it goes.
+func (r *RobotCompiler) encodeOps(ops []op, base int, sourceMap map[int]Position) ([]byte, error) {
+	// Jump addresses need the offset of every op, so work those out first.
+	// A quotation's code doesn't depend on where it ends up, only its source
+	// map does, so that is moved into place afterwards.
+	quotes := make([][]byte, len(ops))
+	quoteMaps := make([]map[int]Position, len(ops))
+	offsets := make([]int, len(ops)+1)
+	for i, o := range ops {
+		size := 0
+		switch {
+		case o.Op == OP_PUSH_VAL && o.Value.Type == T_QUOTE:
+			quoteMaps[i] = make(map[int]Position)
+			code, err := r.encodeOps(o.quote, 0, quoteMaps[i])
+			if err != nil {
+				return nil, err
+			}
+			quotes[i] = code
+			size = 4 + len(code) + len(o.Value.Value.(Quotation).Source) + 1
+		case o.Op == OP_PUSH_VAL:
+			code, err := appendValue(nil, o.Value)
+			if err != nil {
+				return nil, err
+			}
+			size = len(code)
+		case o.Target >= 0:
+			size = 5
+		default:
+			size = 3
+		}
+		offsets[i+1] = offsets[i] + size
+	}
+	if offsets[len(ops)] > 0xffff {
+		return nil, fmt.Errorf("code too long")
+	}
+
+	instructions := make([]byte, 0, offsets[len(ops)])
+	for i, o := range ops {
+		if o.HasPos {
+			sourceMap[base+offsets[i]] = o.Pos
+		}
+		switch {
+		case o.Op == OP_PUSH_VAL && o.Value.Type == T_QUOTE:
+			code := quotes[i]
+			for at, pos := range quoteMaps[i] {
+				sourceMap[base+offsets[i]+4+at] = pos
+			}
+			instructions = append(instructions, byte(OP_PUSH_VAL), byte(T_QUOTE), byte(len(code)>>8), byte(len(code)))
+			instructions = append(instructions, code...)
+			instructions = append(instructions, []byte(o.Value.Value.(Quotation).Source)...)
+			instructions = append(instructions, 0)
+		case o.Op == OP_PUSH_VAL:
+			var err error
+			instructions, err = appendValue(instructions, o.Value)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			var err error
+			instructions, err = r.appendWord(instructions, o.Word)
+			if err != nil {
+				return nil, err
+			}
+			if o.Target >= 0 {
+				instructions = append(instructions, 0, 0)
+				err = patchAddr(instructions, len(instructions), offsets[o.Target])
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return instructions, nil
+}
+
+type optimiser struct {
+	scratch *Robot
+}
+
+// optimise applies the rewrites to ops until none of them change anything.
+func (o *optimiser) optimise(ops []op) []op {
+	for i := range ops {
+		if ops[i].quote != nil {
+			ops[i].quote = o.optimise(ops[i].quote)
+		}
+	}
+	for {
+		var changed bool
+		ops, changed = o.pass(ops)
+		if !changed {
+			return ops
+		}
+	}
+}
+
+// pass makes the first rewrite it can find.
+func (o *optimiser) pass(ops []op) ([]op, bool) {
+	targets := make(map[int]bool)
+	for _, op := range ops {
+		if op.Target >= 0 {
+			targets[op.Target] = true
+		}
+	}
+	// Only the first op of a rewritten run may be jumped to, otherwise the
+	// jump would land in the middle of it.
+	jumpedInto := func(i, n int) bool {
+		for j := i + 1; j < i+n; j++ {
+			if targets[j] {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := range ops {
+		// Constant folding
+		if ops[i].Op == OP_EXEC_WORD {
+			if n, ok := foldable[ops[i].Word]; ok && i >= n && !jumpedInto(i-n, n+1) {
+				if v, ok := o.fold(ops[i-n:i], ops[i].Word); ok {
+					folded := ops[i-n]
+					folded.Value = v
+					return replace(ops, i-n, n+1, folded), true
+				}
+			}
+		}
+
+		if i+1 < len(ops) && !jumpedInto(i, 2) {
+			// Pushing a value only to drop it
+			if ops[i].Op == OP_PUSH_VAL && ops[i+1].isWord("DROP") {
+				return replace(ops, i, 2), true
+			}
+
+			// Branches on a literal boolean
+			if ops[i].isLiteral() && ops[i].Value.Type == T_BOOL && ops[i+1].isWord("IF") {
+				if ops[i].Value.Value.(bool) {
+					return replace(ops, i, 2), true
+				}
+				jmp := ops[i+1]
+				jmp.Word = "JMP"
+				jmp.Pos, jmp.HasPos = ops[i].Pos, ops[i].HasPos
+				return replace(ops, i, 2, jmp), true
+			}
+		}
+
+		// DUP DROP and SWAP SWAP do nothing, but only when there are enough
+		// values on the stack, otherwise they fail. The only values known to
+		// be there are ones pushed just before.
+		if i+2 < len(ops) && ops[i].Op == OP_PUSH_VAL &&
+			ops[i+1].isWord("DUP") && ops[i+2].isWord("DROP") && !jumpedInto(i, 3) {
+			return replace(ops, i+1, 2), true
+		}
+		if i+3 < len(ops) && ops[i].Op == OP_PUSH_VAL && ops[i+1].Op == OP_PUSH_VAL &&
+			ops[i+2].isWord("SWAP") && ops[i+3].isWord("SWAP") && !jumpedInto(i, 4) {
+			return replace(ops, i+2, 2), true
+		}
+
+		if ops[i].isWord("JMP") {
+			// A jump to the next instruction does nothing
+			if ops[i].Target == i+1 {
+				return replace(ops, i, 1), true
+			}
+			// Nothing after a jump runs until something jumps to it
+			end := i + 1
+			for end < len(ops) && !targets[end] {
+				end++
+			}
+			if end > i+1 {
+				return replace(ops, i+1, end-i-1), true
+			}
+		}
+	}
+	return ops, false
+}
+
+// fold runs word against literal arguments, reporting whether it gave a
+// single value that can be pushed instead.
+func (o *optimiser) fold(args []op, word string) (RobotValue, bool) {
+	r := o.scratch
+	*r.RobotValueStack = (*r.RobotValueStack)[:0]
+	for _, arg := range args {
+		if !arg.isLiteral() {
+			return RobotValue{}, false
+		}
+		r.RobotValueStack.Push(arg.Value)
+	}
+	// Errors such as dividing by zero are left for run time
+	err := r.Dictionary[word]()
+	if err != nil || len(*r.RobotValueStack) != 1 {
+		return RobotValue{}, false
+	}
+	v := (*r.RobotValueStack)[0]
+	switch v.Type {
+	case T_INT, T_BOOL, T_STRING, T_DIRECTION:
+		return v, true
+	}
+	return RobotValue{}, false
+}
+
+// replace swaps the n ops at i for with, keeping jumps pointing at the
+// same instructions. Jumps into the replaced ops go to what replaces them.
+func replace(ops []op, i, n int, with ...op) []op {
+	shift := len(with) - n
+	out := make([]op, 0, len(ops)+shift)
+	out = append(out, ops[:i]...)
+	out = append(out, with...)
+	out = append(out, ops[i+n:]...)
+	for j := range out {
+		t := out[j].Target
+		switch {
+		case t >= i+n:
+			out[j].Target = t + shift
+		case t > i && t-i >= len(with):
+			out[j].Target = i + len(with)
+		}
+	}
+	return out
+}
@@ -0,0 +1,264 @@
+package toyrobot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/danwhitford/toyrobot/belt"
+)
+
+// Node is part of the syntax tree of a program.
+type Node interface {
+	Pos() Position
+}
+
+// Literal pushes a number, direction, bool or string.
+type Literal struct {
+	Token Token
+}
+
+// WordCall runs a word.
+type WordCall struct {
+	Token Token
+}
+
+// Conditional is IF ... [ELSE ...] THEN.
+type Conditional struct {
+	If   Token
+	Then []Node
+	// Else is nil if there's no ELSE. ElseToken is the ELSE if there is one.
+	Else      []Node
+	ElseToken *Token
+	End       Token
+}
+
+// TryCatch is TRY ... CATCH ... ENDTRY.
+type TryCatch struct {
+	Try     Token
+	Body    []Node
+	Catch   Token
+	Handler []Node
+	End     Token
+}
+
+// QuotationNode is { ... }.
+type QuotationNode struct {
+	Open  Token
+	Body  []Node
+	Close Token
+}
+
+func (n *Literal) Pos() Position       { return n.Token.Pos }
+func (n *WordCall) Pos() Position      { return n.Token.Pos }
+func (n *Conditional) Pos() Position   { return n.If.Pos }
+func (n *TryCatch) Pos() Position      { return n.Try.Pos }
+func (n *QuotationNode) Pos() Position { return n.Open.Pos }
+
+// Word returns the name of the word called.
+func (n *WordCall) Word() string {
+	return n.Token.Value.(string)
+}
+
+// Source returns the quotation's body as it is kept with the compiled code.
+func (n *QuotationNode) Source() string {
+	tokens := Tokens(n.Body)
+	lexemes := make([]string, len(tokens))
+	for i, token := range tokens {
+		lexemes[i] = token.Lexeme
+	}
+	return strings.Join(lexemes, " ")
+}
+
+// Walk calls fn for every node in nodes, parents before their children, in
+// source order.
+func Walk(nodes []Node, fn func(Node)) {
+	for _, node := range nodes {
+		fn(node)
+		switch n := node.(type) {
+		case *Conditional:
+			Walk(n.Then, fn)
+			Walk(n.Else, fn)
+		case *TryCatch:
+			Walk(n.Body, fn)
+			Walk(n.Handler, fn)
+		case *QuotationNode:
+			Walk(n.Body, fn)
+		}
+	}
+}
+
+// Tokens returns the tokens that make up nodes in source order.
+func Tokens(nodes []Node) []Token {
+	tokens := make([]Token, 0)
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *Literal:
+			tokens = append(tokens, n.Token)
+		case *WordCall:
+			tokens = append(tokens, n.Token)
+		case *Conditional:
+			tokens = append(tokens, n.If)
+			tokens = append(tokens, Tokens(n.Then)...)
+			if n.ElseToken != nil {
+				tokens = append(tokens, *n.ElseToken)
+				tokens = append(tokens, Tokens(n.Else)...)
+			}
+			tokens = append(tokens, n.End)
+		case *TryCatch:
+			tokens = append(tokens, n.Try)
+			tokens = append(tokens, Tokens(n.Body)...)
+			tokens = append(tokens, n.Catch)
+			tokens = append(tokens, Tokens(n.Handler)...)
+			tokens = append(tokens, n.End)
+		case *QuotationNode:
+			tokens = append(tokens, n.Open)
+			tokens = append(tokens, Tokens(n.Body)...)
+			tokens = append(tokens, n.Close)
+		}
+	}
+	return tokens
+}
+
+// Words that end a block. Seeing one where it isn't expected is an error.
+var closers = map[string]string{
+	"THEN":   "THEN without IF",
+	"ELSE":   "ELSE without IF",
+	"CATCH":  "CATCH without TRY",
+	"ENDTRY": "ENDTRY without TRY ... CATCH",
+	"}":      "unmatched }",
+}
+
+type RobotParser struct {
+	tokens *belt.Belt[Token]
+}
+
+// Parse builds the syntax tree for a program.
+func (p *RobotParser) Parse(tokens []Token) ([]Node, error) {
+	p.tokens = belt.NewBelt[Token](tokens)
+	nodes, end, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	if end != nil {
+		return nil, unexpected(*end)
+	}
+	return nodes, nil
+}
+
+// parseBlock parses nodes up to the end of the input or a word that closes
+// a block, which is returned.
+func (p *RobotParser) parseBlock() ([]Node, *Token, error) {
+	nodes := make([]Node, 0)
+	for p.tokens.HasNext() {
+		token, err := p.tokens.GetNext()
+		if err != nil {
+			return nil, nil, err
+		}
+		if token.Type != TOKEN_WORD {
+			nodes = append(nodes, &Literal{Token: token})
+			continue
+		}
+		word := token.Value.(string)
+		if _, ok := closers[word]; ok {
+			return nodes, &token, nil
+		}
+		var node Node
+		switch word {
+		case "IF":
+			node, err = p.parseConditional(token)
+		case "TRY":
+			node, err = p.parseTryCatch(token)
+		case "{":
+			node, err = p.parseQuotation(token)
+		default:
+			node = &WordCall{Token: token}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil, nil
+}
+
+func (p *RobotParser) parseConditional(token Token) (Node, error) {
+	n := &Conditional{If: token}
+	var end *Token
+	var err error
+	n.Then, end, err = p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	if isWord(end, "ELSE") {
+		n.ElseToken = end
+		n.Else, end, err = p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if end == nil || isWord(end, "}") {
+		return nil, &CompileError{Pos: token.Pos, Err: fmt.Errorf("IF without THEN")}
+	}
+	if !isWord(end, "THEN") {
+		return nil, unexpected(*end)
+	}
+	n.End = *end
+	return n, nil
+}
+
+func (p *RobotParser) parseTryCatch(token Token) (Node, error) {
+	n := &TryCatch{Try: token}
+	var end *Token
+	var err error
+	n.Body, end, err = p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	if end == nil || isWord(end, "}") {
+		return nil, &CompileError{Pos: token.Pos, Err: fmt.Errorf("TRY without ENDTRY")}
+	}
+	if !isWord(end, "CATCH") {
+		return nil, unexpected(*end)
+	}
+	n.Catch = *end
+	n.Handler, end, err = p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	if end == nil || isWord(end, "}") {
+		return nil, &CompileError{Pos: token.Pos, Err: fmt.Errorf("TRY without ENDTRY")}
+	}
+	if !isWord(end, "ENDTRY") {
+		return nil, unexpected(*end)
+	}
+	n.End = *end
+	return n, nil
+}
+
+func (p *RobotParser) parseQuotation(token Token) (Node, error) {
+	n := &QuotationNode{Open: token}
+	var end *Token
+	var err error
+	n.Body, end, err = p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	if end == nil {
+		return nil, &CompileError{Pos: token.Pos, Err: fmt.Errorf("unterminated quotation")}
+	}
+	if !isWord(end, "}") {
+		return nil, unexpected(*end)
+	}
+	n.Close = *end
+	return n, nil
+}
+
+func isWord(token *Token, word string) bool {
+	return token != nil && token.Type == TOKEN_WORD && token.Value == word
+}
+
+// unexpected is the error for a word that closes a block that isn't open.
+func unexpected(token Token) error {
+	return &CompileError{Pos: token.Pos, Err: errors.New(closers[token.Value.(string)])}
+}
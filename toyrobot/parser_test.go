@@ -0,0 +1,87 @@
+package toyrobot
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	tokens, err := (&RobotTokeniser{}).Tokenise("1 IF MOVE ELSE { LEFT } CALL THEN\nTRY REPORT CATCH . ENDTRY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok := func(i int) Token { return tokens[i] }
+	elseToken := tok(3)
+
+	want := []Node{
+		&Literal{Token: tok(0)},
+		&Conditional{
+			If:        tok(1),
+			Then:      []Node{&WordCall{Token: tok(2)}},
+			ElseToken: &elseToken,
+			Else: []Node{
+				&QuotationNode{
+					Open:  tok(4),
+					Body:  []Node{&WordCall{Token: tok(5)}},
+					Close: tok(6),
+				},
+				&WordCall{Token: tok(7)},
+			},
+			End: tok(8),
+		},
+		&TryCatch{
+			Try:     tok(9),
+			Body:    []Node{&WordCall{Token: tok(10)}},
+			Catch:   tok(11),
+			Handler: []Node{&WordCall{Token: tok(12)}},
+			End:     tok(13),
+		},
+	}
+
+	got, err := (&RobotParser{}).Parse(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Parse mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(tokens, Tokens(got)); diff != "" {
+		t.Errorf("Tokens mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := got[1].(*Conditional).Else[0].(*QuotationNode).Source(), "LEFT"; got != want {
+		t.Errorf("Source() = %q, want %q", got, want)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	table := []struct {
+		input, want string
+	}{
+		{"1 THEN", "1:3: THEN without IF"},
+		{"ELSE", "1:1: ELSE without IF"},
+		{"TRUE IF 1 ELSE 2 ELSE 3 THEN", "1:18: ELSE without IF"},
+		{"TRUE IF 1", "1:6: IF without THEN"},
+		{"{ TRUE IF 1 }", "1:8: IF without THEN"},
+		{"TRUE IF CATCH THEN", "1:9: CATCH without TRY"},
+		{"TRY 1 ENDTRY", "1:7: ENDTRY without TRY ... CATCH"},
+		{"TRY 1 CATCH 2", "1:1: TRY without ENDTRY"},
+		{"{ 1 2", "1:1: unterminated quotation"},
+		{"1 }", "1:3: unmatched }"},
+	}
+
+	for _, tst := range table {
+		tokens, err := (&RobotTokeniser{}).Tokenise(tst.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = (&RobotParser{}).Parse(tokens)
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded, want %q", tst.input, tst.want)
+			continue
+		}
+		if err.Error() != tst.want {
+			t.Errorf("Parse(%q) error = %q, want %q", tst.input, err, tst.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package toyrobot
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+)
+
+// Frame is the robot as it was at one point in a run.
+type Frame struct {
+	X, Y   int
+	F      Direction
+	Placed bool
+	Trail  Trail
+}
+
+// Frame is the robot as it is now.
+func (r *Robot) Frame() Frame {
+	// Cap the trail so later moves can't write into this frame's copy
+	trail := Trail{
+		Squares: r.Trail.Squares[:len(r.Trail.Squares):len(r.Trail.Squares)],
+		Edges:   r.Trail.Edges[:len(r.Trail.Edges):len(r.Trail.Edges)],
+	}
+	return Frame{X: r.X, Y: r.Y, F: r.F, Placed: r.Placed, Trail: trail}
+}
+
+// MaxFrames is how many frames a robot keeps while recording. Past that the
+// oldest half are dropped, so a long run replays its last moves.
+const MaxFrames = 1000
+
+// record adds a frame if the robot is recording and has changed since the
+// last one.
+func (r *Robot) record() {
+	if !r.Record {
+		return
+	}
+	f := r.Frame()
+	if n := len(r.Frames); n > 0 {
+		last := r.Frames[n-1]
+		if last.X == f.X && last.Y == f.Y && last.F == f.F && last.Placed == f.Placed {
+			return
+		}
+	}
+	if len(r.Frames) >= MaxFrames {
+		r.Frames = append(r.Frames[:0], r.Frames[MaxFrames/2:]...)
+	}
+	r.Frames = append(r.Frames, f)
+}
+
+// Delays in hundredths of a second between frames of a replay, with a longer
+// pause on the last frame before it loops.
+const (
+	frameDelay     = 40
+	lastFrameDelay = 200
+)
+
+var replayPalette = color.Palette{colourBackground, colourGrid, colourTrail, colourRobot}
+
+// RenderGIF draws the frames as an animated GIF that loops forever.
+func RenderGIF(w io.Writer, frames []Frame) error {
+	if len(frames) == 0 {
+		return errors.New("no frames to replay")
+	}
+	anim := &gif.GIF{}
+	for i, f := range frames {
+		img := f.Image()
+		paletted := image.NewPaletted(img.Bounds(), replayPalette)
+		draw.Draw(paletted, img.Bounds(), img, image.Point{}, draw.Src)
+		delay := frameDelay
+		if i == len(frames)-1 {
+			delay = lastFrameDelay
+		}
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, delay)
+	}
+	return gif.EncodeAll(w, anim)
+}
@@ -0,0 +1,85 @@
+package toyrobot
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ReportFormat is how REPORT prints the robot.
+type ReportFormat byte
+
+const (
+	// X,Y,F as in the original toy robot
+	REPORT_TEXT ReportFormat = iota
+	// The whole of the robot's state, as REPORT-JSON prints it
+	REPORT_JSON
+)
+
+// State is everything about the robot, for tools that would rather not parse
+// REPORT's output. X, Y and F are only set when the robot is placed.
+type State struct {
+	Placed bool        `json:"placed"`
+	X      *int        `json:"x,omitempty"`
+	Y      *int        `json:"y,omitempty"`
+	F      string      `json:"f,omitempty"`
+	Stack  []JSONValue `json:"stack"`
+	World  World       `json:"world"`
+}
+
+// World describes the board the robot is on.
+type World struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// JSONValue is a value on the stack with its type. Directions are their
+// names, lists are JSONValues and quotations are their source.
+type JSONValue struct {
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+// State is the robot as it is now, with the stack bottom first.
+func (r *Robot) State() State {
+	s := State{
+		Placed: r.Placed,
+		Stack:  make([]JSONValue, len(*r.RobotValueStack)),
+		World:  World{Width: BoardSize, Height: BoardSize},
+	}
+	if r.Placed {
+		x, y := r.X, r.Y
+		s.X, s.Y, s.F = &x, &y, r.F.String()
+	}
+	for i, v := range *r.RobotValueStack {
+		s.Stack[i] = jsonValue(v)
+	}
+	return s
+}
+
+func jsonValue(v RobotValue) JSONValue {
+	switch v.Type {
+	case T_DIRECTION:
+		return JSONValue{v.Type.String(), v.Value.(Direction).String()}
+	case T_QUOTE:
+		return JSONValue{v.Type.String(), v.Value.(Quotation).Source}
+	case T_LIST:
+		items := v.Value.([]RobotValue)
+		values := make([]JSONValue, len(items))
+		for i, item := range items {
+			values[i] = jsonValue(item)
+		}
+		return JSONValue{v.Type.String(), values}
+	default:
+		return JSONValue{v.Type.String(), v.Value}
+	}
+}
+
+// Implement REPORT-JSON
+func (r *Robot) reportJSON() error {
+	b, err := json.Marshal(r.State())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(r.Output, string(b))
+	return nil
+}
@@ -12,11 +12,13 @@ func _() {
 	_ = x[T_DIRECTION-1]
 	_ = x[T_BOOL-2]
 	_ = x[T_STRING-3]
+	_ = x[T_LIST-4]
+	_ = x[T_QUOTE-5]
 }
 
-const _RobotType_name = "T_INTT_DIRECTIONT_BOOLT_STRING"
+const _RobotType_name = "T_INTT_DIRECTIONT_BOOLT_STRINGT_LISTT_QUOTE"
 
-var _RobotType_index = [...]uint8{0, 5, 16, 22, 30}
+var _RobotType_index = [...]uint8{0, 5, 16, 22, 30, 36, 43}
 
 func (i RobotType) String() string {
 	if i >= RobotType(len(_RobotType_index)-1) {
@@ -2,15 +2,27 @@ package toyrobot
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/danwhitford/toyrobot/belt"
 )
 
 type RobotTokeniser struct {
-	input *belt.Belt[rune]
+	// Comments holds the comments skipped by the last call to Tokenise.
+	Comments []Comment
+
+	input      *belt.Belt[rune]
+	lineStarts []int
+}
+
+// Comment is a # comment, which runs to the end of the line.
+type Comment struct {
+	Pos  Position
+	Text string
 }
 
 type TokenType byte
@@ -28,54 +40,89 @@ type Token struct {
 	Type   TokenType
 	Value  any
 	Lexeme string
+	Pos    Position
+}
+
+// Position is a 1-based line and column in the source.
+type Position struct {
+	Line, Col int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
 }
 
 func (t *RobotTokeniser) Tokenise(input string) ([]Token, error) {
 	tokens := make([]Token, 0)
 
-	t.input = belt.NewBelt[rune]([]rune(input))
+	runes := []rune(input)
+	t.Comments = nil
+	t.input = belt.NewBelt[rune](runes)
+	t.lineStarts = []int{0}
+	for i, c := range runes {
+		if c == '\n' {
+			t.lineStarts = append(t.lineStarts, i+1)
+		}
+	}
 
 	for t.input.HasNext() {
 		currentRune, err := t.input.Peek()
 		if err != nil {
 			return []Token{}, err
 		}
+		pos := t.position()
 		switch {
 		case unicode.IsDigit(currentRune):
 			token, err := t.getTokenNumber()
 			if err != nil {
-				return []Token{}, err
+				return []Token{}, &CompileError{Pos: pos, Err: err}
 			}
+			token.Pos = pos
 			tokens = append(tokens, token)
 		case currentRune == '#':
+			var text strings.Builder
 			for currentRune != '\n' && t.input.HasNext() {
 				currentRune, err = t.input.GetNext()
 				if err != nil {
 					return []Token{}, err
 				}
+				if currentRune != '\n' {
+					text.WriteRune(currentRune)
+				}
 			}
+			t.Comments = append(t.Comments, Comment{Pos: pos, Text: strings.TrimRightFunc(text.String(), unicode.IsSpace)})
 		case currentRune == '"':
 			token, err := t.getTokenString()
 			if err != nil {
-				return []Token{}, err
+				return []Token{}, &CompileError{Pos: pos, Err: err}
 			}
+			token.Pos = pos
 			tokens = append(tokens, token)
 		case !unicode.IsSpace(currentRune) && unicode.IsPrint(currentRune):
 			token, err := t.getTokenAlpha()
 			if err != nil {
-				return []Token{}, err
+				return []Token{}, &CompileError{Pos: pos, Err: err}
 			}
+			token.Pos = pos
 			tokens = append(tokens, token)
 		case unicode.IsSpace(currentRune):
 			t.input.GetNext()
 		default:
-			return []Token{}, fmt.Errorf("invalid token, unexpected '%s'", string(currentRune))
+			return []Token{}, &CompileError{Pos: pos, Err: fmt.Errorf("invalid token, unexpected '%s'", string(currentRune))}
 		}
 	}
 
 	return tokens, nil
 }
 
+// position returns the line and column of the next rune to be read.
+func (t *RobotTokeniser) position() Position {
+	line := sort.Search(len(t.lineStarts), func(i int) bool {
+		return t.lineStarts[i] > t.input.Ptr
+	})
+	return Position{Line: line, Col: t.input.Ptr - t.lineStarts[line-1] + 1}
+}
+
 func (t *RobotTokeniser) getTokenNumber() (Token, error) {
 	lexeme, err := t.getLexeme()
 	if err != nil {
@@ -133,18 +180,98 @@ func (t *RobotTokeniser) getTokenString() (Token, error) {
 	if err != nil {
 		return Token{}, err
 	}
-	lexeme := ""
+	var value, raw strings.Builder
 	for t.input.HasNext() {
-		curr, err := t.input.GetNext()
+		currentRune, err := t.input.GetNext()
 		if err != nil {
 			return Token{}, err
 		}
-		currentRune := curr
-		if currentRune == '"' {
-			return Token{TOKEN_STRING, lexeme, fmt.Sprintf("\"%s\"", lexeme)}, nil
-		} else {
-			lexeme += string(currentRune)
+		switch currentRune {
+		case '"':
+			return Token{Type: TOKEN_STRING, Value: value.String(), Lexeme: fmt.Sprintf("\"%s\"", raw.String())}, nil
+		case '\\':
+			escaped, lexeme, err := t.getEscape()
+			if err != nil {
+				return Token{}, err
+			}
+			value.WriteRune(escaped)
+			raw.WriteString(lexeme)
+		default:
+			value.WriteRune(currentRune)
+			raw.WriteRune(currentRune)
 		}
 	}
 	return Token{}, fmt.Errorf("unterminated string")
 }
+
+// getEscape reads the rest of an escape sequence after the backslash and
+// returns the rune it stands for along with its source text.
+func (t *RobotTokeniser) getEscape() (rune, string, error) {
+	if !t.input.HasNext() {
+		return 0, "", fmt.Errorf("unterminated string")
+	}
+	curr, err := t.input.GetNext()
+	if err != nil {
+		return 0, "", err
+	}
+	switch curr {
+	case '"':
+		return '"', `\"`, nil
+	case '\\':
+		return '\\', `\\`, nil
+	case 'n':
+		return '\n', `\n`, nil
+	case 't':
+		return '\t', `\t`, nil
+	case 'u':
+		open, err := t.input.GetNext()
+		if err != nil || open != '{' {
+			return 0, "", fmt.Errorf("invalid escape, expecting '{' after '\\u'")
+		}
+		hex := ""
+		for {
+			if !t.input.HasNext() {
+				return 0, "", fmt.Errorf("unterminated string")
+			}
+			c, err := t.input.GetNext()
+			if err != nil {
+				return 0, "", err
+			}
+			if c == '}' {
+				break
+			}
+			hex += string(c)
+		}
+		code, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || code == 0 || !utf8.ValidRune(rune(code)) {
+			return 0, "", fmt.Errorf("invalid escape '\\u{%s}'", hex)
+		}
+		return rune(code), fmt.Sprintf("\\u{%s}", hex), nil
+	default:
+		return 0, "", fmt.Errorf("invalid escape '\\%s'", string(curr))
+	}
+}
+
+// quoteString renders s as a string literal the tokeniser can read back.
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteRune('"')
+	for _, c := range s {
+		switch {
+		case c == '"':
+			sb.WriteString(`\"`)
+		case c == '\\':
+			sb.WriteString(`\\`)
+		case c == '\n':
+			sb.WriteString(`\n`)
+		case c == '\t':
+			sb.WriteString(`\t`)
+		case !unicode.IsPrint(c):
+			fmt.Fprintf(&sb, "\\u{%x}", c)
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	sb.WriteRune('"')
+	return sb.String()
+}
@@ -14,76 +14,93 @@ func TestTokenise(t *testing.T) {
 		{
 			"3 2 NORTH PLACE",
 			[]Token{
-				{Type: TOKEN_NUMBER, Value: 3, Lexeme: "3"},
-				{Type: TOKEN_NUMBER, Value: 2, Lexeme: "2"},
-				{Type: TOKEN_DIRECTION, Value: NORTH, Lexeme: "NORTH"},
-				{Type: TOKEN_WORD, Value: "PLACE", Lexeme: "PLACE"},
+				{Type: TOKEN_NUMBER, Value: 3, Lexeme: "3", Pos: Position{1, 1}},
+				{Type: TOKEN_NUMBER, Value: 2, Lexeme: "2", Pos: Position{1, 3}},
+				{Type: TOKEN_DIRECTION, Value: NORTH, Lexeme: "NORTH", Pos: Position{1, 5}},
+				{Type: TOKEN_WORD, Value: "PLACE", Lexeme: "PLACE", Pos: Position{1, 11}},
 			},
 		},
 		{
 			"RIGHT",
 			[]Token{
-				{Type: TOKEN_WORD, Value: "RIGHT", Lexeme: "RIGHT"},
+				{Type: TOKEN_WORD, Value: "RIGHT", Lexeme: "RIGHT", Pos: Position{1, 1}},
 			},
 		},
 		{
 			"REPORT",
 			[]Token{
-				{Type: TOKEN_WORD, Value: "REPORT", Lexeme: "REPORT"},
+				{Type: TOKEN_WORD, Value: "REPORT", Lexeme: "REPORT", Pos: Position{1, 1}},
 			},
 		},
 		{
 			"MOVE LEFT RIGHT REPORT",
 			[]Token{
-				{Type: TOKEN_WORD, Value: "MOVE", Lexeme: "MOVE"},
-				{Type: TOKEN_WORD, Value: "LEFT", Lexeme: "LEFT"},
-				{Type: TOKEN_WORD, Value: "RIGHT", Lexeme: "RIGHT"},
-				{Type: TOKEN_WORD, Value: "REPORT", Lexeme: "REPORT"},
+				{Type: TOKEN_WORD, Value: "MOVE", Lexeme: "MOVE", Pos: Position{1, 1}},
+				{Type: TOKEN_WORD, Value: "LEFT", Lexeme: "LEFT", Pos: Position{1, 6}},
+				{Type: TOKEN_WORD, Value: "RIGHT", Lexeme: "RIGHT", Pos: Position{1, 11}},
+				{Type: TOKEN_WORD, Value: "REPORT", Lexeme: "REPORT", Pos: Position{1, 17}},
 			},
 		},
 		{
 			"NORTH SOUTH EAST WEST",
 			[]Token{
-				{Type: TOKEN_DIRECTION, Value: NORTH, Lexeme: "NORTH"},
-				{Type: TOKEN_DIRECTION, Value: SOUTH, Lexeme: "SOUTH"},
-				{Type: TOKEN_DIRECTION, Value: EAST, Lexeme: "EAST"},
-				{Type: TOKEN_DIRECTION, Value: WEST, Lexeme: "WEST"},
+				{Type: TOKEN_DIRECTION, Value: NORTH, Lexeme: "NORTH", Pos: Position{1, 1}},
+				{Type: TOKEN_DIRECTION, Value: SOUTH, Lexeme: "SOUTH", Pos: Position{1, 7}},
+				{Type: TOKEN_DIRECTION, Value: EAST, Lexeme: "EAST", Pos: Position{1, 13}},
+				{Type: TOKEN_DIRECTION, Value: WEST, Lexeme: "WEST", Pos: Position{1, 18}},
 			},
 		},
 		{
 			"10 20 30 40",
 			[]Token{
-				{Type: TOKEN_NUMBER, Value: 10, Lexeme: "10"},
-				{Type: TOKEN_NUMBER, Value: 20, Lexeme: "20"},
-				{Type: TOKEN_NUMBER, Value: 30, Lexeme: "30"},
-				{Type: TOKEN_NUMBER, Value: 40, Lexeme: "40"},
+				{Type: TOKEN_NUMBER, Value: 10, Lexeme: "10", Pos: Position{1, 1}},
+				{Type: TOKEN_NUMBER, Value: 20, Lexeme: "20", Pos: Position{1, 4}},
+				{Type: TOKEN_NUMBER, Value: 30, Lexeme: "30", Pos: Position{1, 7}},
+				{Type: TOKEN_NUMBER, Value: 40, Lexeme: "40", Pos: Position{1, 10}},
 			},
 		},
 		{
 			"+ - * /",
 			[]Token{
-				{Type: TOKEN_WORD, Value: "+", Lexeme: "+"},
-				{Type: TOKEN_WORD, Value: "-", Lexeme: "-"},
-				{Type: TOKEN_WORD, Value: "*", Lexeme: "*"},
-				{Type: TOKEN_WORD, Value: "/", Lexeme: "/"},
+				{Type: TOKEN_WORD, Value: "+", Lexeme: "+", Pos: Position{1, 1}},
+				{Type: TOKEN_WORD, Value: "-", Lexeme: "-", Pos: Position{1, 3}},
+				{Type: TOKEN_WORD, Value: "*", Lexeme: "*", Pos: Position{1, 5}},
+				{Type: TOKEN_WORD, Value: "/", Lexeme: "/", Pos: Position{1, 7}},
 			},
 		},
 		{
 			"\"hello world\"",
 			[]Token{
-				{Type: TOKEN_STRING, Value: "hello world", Lexeme: "\"hello world\""},
+				{Type: TOKEN_STRING, Value: "hello world", Lexeme: "\"hello world\"", Pos: Position{1, 1}},
+			},
+		},
+		{
+			`"say \"hi\"\n\tC:\\ \u{2191}"`,
+			[]Token{
+				{Type: TOKEN_STRING, Value: "say \"hi\"\n\tC:\\ ↑", Lexeme: `"say \"hi\"\n\tC:\\ \u{2191}"`, Pos: Position{1, 1}},
+			},
+		},
+		{
+			"0 0 NORTH PLACE # start\n  MOVE\nREPORT",
+			[]Token{
+				{Type: TOKEN_NUMBER, Value: 0, Lexeme: "0", Pos: Position{1, 1}},
+				{Type: TOKEN_NUMBER, Value: 0, Lexeme: "0", Pos: Position{1, 3}},
+				{Type: TOKEN_DIRECTION, Value: NORTH, Lexeme: "NORTH", Pos: Position{1, 5}},
+				{Type: TOKEN_WORD, Value: "PLACE", Lexeme: "PLACE", Pos: Position{1, 11}},
+				{Type: TOKEN_WORD, Value: "MOVE", Lexeme: "MOVE", Pos: Position{2, 3}},
+				{Type: TOKEN_WORD, Value: "REPORT", Lexeme: "REPORT", Pos: Position{3, 1}},
 			},
 		},
 		{
 			"15 5 GT IF \"15 is bigger than 5\" . FI",
 			[]Token{
-				{Type: TOKEN_NUMBER, Value: 15, Lexeme: "15"},
-				{Type: TOKEN_NUMBER, Value: 5, Lexeme: "5"},
-				{Type: TOKEN_WORD, Value: "GT", Lexeme: "GT"},
-				{Type: TOKEN_WORD, Value: "IF", Lexeme: "IF"},
-				{Type: TOKEN_STRING, Value: "15 is bigger than 5", Lexeme: "\"15 is bigger than 5\""},
-				{Type: TOKEN_WORD, Value: ".", Lexeme: "."},
-				{Type: TOKEN_WORD, Value: "FI", Lexeme: "FI"},
+				{Type: TOKEN_NUMBER, Value: 15, Lexeme: "15", Pos: Position{1, 1}},
+				{Type: TOKEN_NUMBER, Value: 5, Lexeme: "5", Pos: Position{1, 4}},
+				{Type: TOKEN_WORD, Value: "GT", Lexeme: "GT", Pos: Position{1, 6}},
+				{Type: TOKEN_WORD, Value: "IF", Lexeme: "IF", Pos: Position{1, 9}},
+				{Type: TOKEN_STRING, Value: "15 is bigger than 5", Lexeme: "\"15 is bigger than 5\"", Pos: Position{1, 12}},
+				{Type: TOKEN_WORD, Value: ".", Lexeme: ".", Pos: Position{1, 34}},
+				{Type: TOKEN_WORD, Value: "FI", Lexeme: "FI", Pos: Position{1, 36}},
 			},
 		},
 	}
@@ -106,7 +123,11 @@ func TestTokenise_Errors(t *testing.T) {
 		input         string
 		expectedError string
 	}{
-		{"10 10 EQ IF \"equal\" . ELSE \"not equal\" . \" FI", "unterminated string"},
+		{"10 10 EQ IF \"equal\" . ELSE \"not equal\" . \" FI", "1:42: unterminated string"},
+		{`"bad \q escape"`, "1:1: invalid escape '\\q'"},
+		{`"bad \u{zz}"`, "1:1: invalid escape '\\u{zz}'"},
+		{`"bad \u2191"`, "1:1: invalid escape, expecting '{' after '\\u'"},
+		{`"trailing \`, "1:1: unterminated string"},
 	}
 
 	for _, tst := range table {
@@ -1,6 +1,9 @@
 package toyrobot
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -20,6 +23,70 @@ type Robot struct {
 	RobotValueStack *stack.RobotStack[RobotValue]
 	Dictionary      map[string]func() error
 	Instructions    *belt.Belt[byte]
+
+	// Trail is where the robot has been since it was last placed.
+	Trail Trail
+
+	// Record, if set, adds a frame to Frames every time the robot is
+	// placed, moves or turns, for RenderGIF to replay. Frames only holds the
+	// last program run, and only its latest moves once there are MaxFrames.
+	Record bool
+	Frames []Frame
+
+	// ReportFormat is how REPORT prints the robot.
+	ReportFormat ReportFormat
+
+	// BoardStyle is how BOARD draws the board.
+	BoardStyle BoardStyle
+
+	// CreateFile, if set, opens files for words like SAVE-PNG to write to.
+	// It's unset by default so that programs can't write files unless the
+	// caller allows it.
+	CreateFile func(path string) (io.WriteCloser, error)
+
+	// Hook, if set, is called before each instruction is run. Returning an
+	// error from it stops the program with that error.
+	Hook func(Step) error
+
+	// Trace, if set, gets a line for every instruction that is run.
+	Trace       io.Writer
+	TraceFormat TraceFormat
+
+	// Optimise, if set, runs the optimiser over programs before they're run.
+	Optimise bool
+
+	// Limits for running untrusted programs. Zero means no limit.
+	// MaxValueSize is the biggest string or list, in bytes as printed, a
+	// program can make. Without it a program can double a string each time
+	// round a loop and run out of memory well within the other limits.
+	MaxInstructions int
+	MaxStackDepth   int
+	MaxValueSize    int
+
+	// The source map of the running program, the offset of the running
+	// code within it and the offset of the current instruction.
+	sourceMap map[int]Position
+	base      int
+	pc        int
+	depth     int
+
+	ctx      context.Context
+	executed int
+
+	// Dictionary entries for the words in the compiler's word table
+	bound []func() error
+
+	listMarks stack.RobotStack[int]
+	handlers  stack.RobotStack[handler]
+}
+
+// handler records where to resume, and the stack to go back to, when an
+// error is raised inside a TRY block.
+type handler struct {
+	catch        int
+	stack        []RobotValue
+	marks        int
+	instructions *belt.Belt[byte]
 }
 
 func NewRobot() *Robot {
@@ -29,7 +96,7 @@ func NewRobot() *Robot {
 	r := Robot{
 		Output:          os.Stdout,
 		RobotTokeniser:  &RobotTokeniser{},
-		RobotCompiler:   &RobotCompiler{},
+		RobotCompiler:   &RobotCompiler{Words: NewWordTable()},
 		RobotValueStack: &stack,
 		Dictionary:      dict,
 	}
@@ -38,86 +105,245 @@ func NewRobot() *Robot {
 	return &r
 }
 
+// Step describes an instruction that is about to be run.
+type Step struct {
+	// Offset of the instruction in the block of code being run
+	Offset int
+	// Where the instruction came from in the source, if known
+	Pos    Position
+	HasPos bool
+	// How many quotations deep the instruction is
+	Depth int
+	Op    Instruction
+	// The value pushed by OP_PUSH_VAL or the word run by OP_EXEC_WORD
+	Value RobotValue
+	Word  string
+	word  int
+}
+
 func (r *Robot) runInstructions() error {
 	for r.Instructions.HasNext() {
-		currentInstruction, err := r.Instructions.GetNext()
+		err := r.checkLimits()
+		if err != nil {
+			return err
+		}
+		r.pc = r.Instructions.Ptr
+		step, err := r.decode()
 		if err != nil {
 			return err
 		}
-		switch currentInstruction {
-		case byte(OP_PUSH_VAL):
-			typeInstruction, err := r.Instructions.GetNext()
+		if r.Hook != nil {
+			err = r.Hook(step)
 			if err != nil {
 				return err
 			}
-			t := RobotType(typeInstruction)
-			switch t {
-			case T_INT:
-				vi, err := r.Instructions.GetNext()
-				if err != nil {
-					return err
-				}
-				v := int(vi)
-				r.RobotValueStack.Push(RobotValue{Type: t, Value: v})
-			case T_DIRECTION:
-				vi, err := r.Instructions.GetNext()
-				if err != nil {
-					return err
-				}
-				v := Direction(vi)
-				r.RobotValueStack.Push(RobotValue{Type: t, Value: v})
-			case T_BOOL:
-				vi, err := r.Instructions.GetNext()
-				if err != nil {
-					return err
-				}
-				v := vi != 0
-				r.RobotValueStack.Push(RobotValue{Type: t, Value: v})
-			case T_STRING:
-				vs := make([]byte, 0)
-				vi, err := r.Instructions.GetNext()
-				if err != nil {
-					return err
-				}
-				for vi != 0 {
-					vs = append(vs, vi)
-					vi, err = r.Instructions.GetNext()
-					if err != nil {
-						return err
-					}
-				}
-				v := string(vs)
-				r.RobotValueStack.Push(RobotValue{Type: t, Value: v})
-			default:
-				return fmt.Errorf("invalid type %s", t)
+		}
+		var before robotState
+		if r.Trace != nil {
+			before = r.snapshot()
+		}
+		err = r.execute(step)
+		if r.Trace != nil {
+			r.trace(step, before, err)
+		}
+		if err != nil && r.catch(err) {
+			err = nil
+		}
+		if err == nil {
+			err = r.checkStack()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Robot) execute(step Step) error {
+	switch step.Op {
+	case OP_PUSH_VAL:
+		r.RobotValueStack.Push(step.Value)
+	case OP_EXEC_WORD:
+		fn, ok := r.lookup(step.word)
+		if !ok {
+			return &UnknownWordError{Word: step.Word}
+		}
+		return fn()
+	}
+	return nil
+}
+
+// decode reads the next instruction and its operands.
+func (r *Robot) decode() (Step, error) {
+	step := Step{Offset: r.pc, Depth: r.depth}
+	if r.Hook != nil || r.Trace != nil {
+		step.Pos, step.HasPos = r.position()
+	}
+	currentInstruction, err := r.Instructions.GetNext()
+	if err != nil {
+		return step, err
+	}
+	step.Op = Instruction(currentInstruction)
+	switch step.Op {
+	case OP_PUSH_VAL:
+		typeInstruction, err := r.Instructions.GetNext()
+		if err != nil {
+			return step, err
+		}
+		t := RobotType(typeInstruction)
+		switch t {
+		case T_INT:
+			v, err := binary.ReadVarint(byteReader{r.Instructions})
+			if err != nil {
+				return step, err
 			}
-		case byte(OP_EXEC_WORD):
-			wordBytes := make([]byte, 0)
-			t, err := r.Instructions.GetNext()
+			step.Value = RobotValue{Type: t, Value: int(v)}
+		case T_DIRECTION:
+			vi, err := r.Instructions.GetNext()
 			if err != nil {
-				return err
+				return step, err
+			}
+			v := Direction(vi)
+			step.Value = RobotValue{Type: t, Value: v}
+		case T_BOOL:
+			vi, err := r.Instructions.GetNext()
+			if err != nil {
+				return step, err
+			}
+			v := vi != 0
+			step.Value = RobotValue{Type: t, Value: v}
+		case T_STRING:
+			v, err := r.readString()
+			if err != nil {
+				return step, err
 			}
-			for t != 0 {
-				wordBytes = append(wordBytes, t)
-				t, err = r.Instructions.GetNext()
+			step.Value = RobotValue{Type: t, Value: v}
+		case T_QUOTE:
+			hi, err := r.Instructions.GetNext()
+			if err != nil {
+				return step, err
+			}
+			lo, err := r.Instructions.GetNext()
+			if err != nil {
+				return step, err
+			}
+			base := r.base + r.Instructions.Ptr
+			code := make([]byte, int(hi)<<8|int(lo))
+			for i := range code {
+				code[i], err = r.Instructions.GetNext()
 				if err != nil {
-					return err
+					return step, err
 				}
 			}
-			word := string(wordBytes)
-			fn, ok := r.Dictionary[word]
-			if !ok {
-				return fmt.Errorf("unknown word '%s'", word)
-			}
-			err = fn()
+			source, err := r.readString()
 			if err != nil {
-				return err
+				return step, err
 			}
+			v := Quotation{
+				Code:      code,
+				Source:    source,
+				sourceMap: r.sourceMap,
+				base:      base,
+			}
+			step.Value = RobotValue{Type: t, Value: v}
 		default:
-			return fmt.Errorf("RUNTIME ERR: invalid instruction %v\n%#v", currentInstruction, r.Instructions)
+			return step, fmt.Errorf("invalid type %s", t)
+		}
+	case OP_EXEC_WORD:
+		hi, err := r.Instructions.GetNext()
+		if err != nil {
+			return step, err
 		}
+		lo, err := r.Instructions.GetNext()
+		if err != nil {
+			return step, err
+		}
+		step.word = int(hi)<<8 | int(lo)
+		step.Word = r.RobotCompiler.Words.Name(step.word)
+	default:
+		return step, fmt.Errorf("RUNTIME ERR: invalid instruction %v\n%#v", currentInstruction, r.Instructions)
 	}
-	return nil
+	return step, nil
+}
+
+// byteReader lets encoding/binary read varints from the instructions.
+type byteReader struct {
+	*belt.Belt[byte]
+}
+
+func (b byteReader) ReadByte() (byte, error) {
+	return b.GetNext()
+}
+
+// readString reads a NUL terminated string from the instructions.
+func (r *Robot) readString() (string, error) {
+	bytes := make([]byte, 0)
+	b, err := r.Instructions.GetNext()
+	if err != nil {
+		return "", err
+	}
+	for b != 0 {
+		bytes = append(bytes, b)
+		b, err = r.Instructions.GetNext()
+		if err != nil {
+			return "", err
+		}
+	}
+	return string(bytes), nil
+}
+
+// catch hands err to the innermost TRY block if it belongs to the code that
+// is currently running, reporting whether the error was dealt with.
+func (r *Robot) catch(err error) bool {
+	var u uncatchable
+	if errors.As(err, &u) || len(r.handlers) == 0 {
+		return false
+	}
+	h := r.handlers[len(r.handlers)-1]
+	if h.instructions != r.Instructions {
+		return false
+	}
+	r.handlers.Pop()
+	*r.RobotValueStack = h.stack
+	if len(r.listMarks) > h.marks {
+		r.listMarks = r.listMarks[:h.marks]
+	}
+	r.RobotValueStack.Push(RobotValue{Type: T_STRING, Value: err.Error()})
+	r.Instructions.Ptr = h.catch
+	return true
+}
+
+// call runs a quotation's code against the robot and then carries on with
+// the code that called it.
+func (r *Robot) call(q Quotation) error {
+	err := r.checkLimits()
+	if err != nil {
+		return err
+	}
+	caller, sourceMap, base, pc := r.Instructions, r.sourceMap, r.base, r.pc
+	r.depth++
+	defer func() {
+		r.Instructions, r.sourceMap, r.base, r.pc = caller, sourceMap, base, pc
+		r.depth--
+	}()
+	r.Instructions = belt.NewBelt[byte](q.Code)
+	r.sourceMap = q.sourceMap
+	r.base = q.base
+	return r.runInstructions()
+}
+
+// position returns where in the source the current instruction came from.
+func (r *Robot) position() (Position, bool) {
+	pos, ok := r.sourceMap[r.base+r.pc]
+	return pos, ok
+}
+
+// state describes where the robot is for use in messages.
+func (r *Robot) state() string {
+	if !r.Placed {
+		return "not placed"
+	}
+	return fmt.Sprintf("%d,%d,%s", r.X, r.Y, r.F)
 }
 
 func (r *Robot) RunProgram(instruction string) error {
@@ -129,6 +355,19 @@ func (r *Robot) RunProgram(instruction string) error {
 	if err != nil {
 		return err
 	}
+	if r.Optimise {
+		instructions, err = r.RobotCompiler.Optimise(instructions)
+		if err != nil {
+			return err
+		}
+	}
+	r.bindWords()
 	r.Instructions = belt.NewBelt[byte](instructions)
+	r.sourceMap = r.RobotCompiler.SourceMap
+	r.base = 0
+	r.depth = 0
+	r.executed = 0
+	r.handlers = nil
+	r.Frames = nil
 	return r.runInstructions()
 }
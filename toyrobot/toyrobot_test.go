@@ -2,8 +2,11 @@ package toyrobot
 
 import (
 	"bytes"
+	"context"
 	"embed"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"testing"
 
@@ -167,6 +170,42 @@ func TestReportInstruction(t *testing.T) {
 	}
 }
 
+func TestReportJSON(t *testing.T) {
+	table := []struct {
+		instruction string
+		format      ReportFormat
+		report      string
+	}{
+		{"REPORT-JSON", REPORT_TEXT, `{"placed":false,"stack":[],"world":{"width":5,"height":5}}` + "\n"},
+		{"0 0 NORTH PLACE REPORT", REPORT_JSON, `{"placed":true,"x":0,"y":0,"f":"NORTH","stack":[],"world":{"width":5,"height":5}}` + "\n"},
+		{
+			`3 4 WEST PLACE 7 "hi" [ 1 EAST ] { MOVE } TRUE REPORT-JSON`,
+			REPORT_TEXT,
+			`{"placed":true,"x":3,"y":4,"f":"WEST","stack":[` +
+				`{"type":"T_INT","value":7},` +
+				`{"type":"T_STRING","value":"hi"},` +
+				`{"type":"T_LIST","value":[{"type":"T_INT","value":1},{"type":"T_DIRECTION","value":"EAST"}]},` +
+				`{"type":"T_QUOTE","value":"MOVE"},` +
+				`{"type":"T_BOOL","value":true}` +
+				`],"world":{"width":5,"height":5}}` + "\n",
+		},
+	}
+
+	for _, tst := range table {
+		var buffer bytes.Buffer
+		robot := NewRobot()
+		robot.Output = &buffer
+		robot.ReportFormat = tst.format
+		err := robot.RunProgram(tst.instruction)
+		if err != nil {
+			t.Fatalf("Error reading instruction %s: %s", tst.instruction, err)
+		}
+		if diff := cmp.Diff(tst.report, buffer.String()); diff != "" {
+			t.Errorf("report of %s mismatch (-want +got):\n%s", tst.instruction, diff)
+		}
+	}
+}
+
 func TestManyInstructionsOnOneLine(t *testing.T) {
 	table := []struct {
 		instruction    string
@@ -198,57 +237,419 @@ func TestManyInstructionsOnOneLine(t *testing.T) {
 	}
 }
 
+func TestAssertions(t *testing.T) {
+	table := []struct {
+		program string
+		err     string
+	}{
+		{"1 1 = ASSERT 0 0 NORTH PLACE 0 0 NORTH ASSERT-POS 2 2 + 4 ASSERT=", ""},
+		{"1 2 =\n  ASSERT", "assertion failed at 2:3: condition was false (robot not placed)"},
+		{"FALSE \"should hold\" ASSERT", "assertion failed at 1:21: should hold (robot not placed)"},
+		{"[ 1 2 ] [ 1 3 ] ASSERT=", "assertion failed at 1:17: expected [ 1 3 ], got [ 1 2 ] (robot not placed)"},
+		{"1 2 EAST PLACE MOVE\n1 2 EAST ASSERT-POS", "assertion failed at 2:10: expected robot at 1,2,EAST (robot 2,2,EAST)"},
+		{"{ 1 0 > ASSERT\n FALSE ASSERT } CALL", "assertion failed at 2:8: condition was false (robot not placed)"},
+	}
+
+	for _, tst := range table {
+		robot := NewRobot()
+		robot.Output = &bytes.Buffer{}
+		err := robot.RunProgram(tst.program)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tst.err {
+			t.Errorf("RunProgram(%q) error = %q, want %q", tst.program, got, tst.err)
+		}
+	}
+}
+
+func TestHook(t *testing.T) {
+	robot := NewRobot()
+	var got []string
+	robot.Hook = func(step Step) error {
+		what := step.Word
+		if step.Op == OP_PUSH_VAL {
+			what = step.Value.Literal()
+		}
+		got = append(got, fmt.Sprintf("%s %d %s", step.Pos, step.Depth, what))
+		return nil
+	}
+	err := robot.RunProgram("1 2 +\n{ DROP } CALL")
+	if err != nil {
+		t.Fatalf("RunProgram returned error %s", err)
+	}
+	want := []string{
+		"1:1 0 1",
+		"1:3 0 2",
+		"1:5 0 +",
+		"2:1 0 { DROP }",
+		"2:10 0 CALL",
+		"2:3 1 DROP",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Hook steps mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	table := []struct {
+		format TraceFormat
+		want   string
+	}{
+		{
+			TRACE_TEXT,
+			`0000 1:1    1            [ 1 ]
+0003 1:3    0            [ 1 0 ]
+0006 1:5    NORTH        [ 1 0 NORTH ]
+0009 1:11   PLACE        [ ] robot not placed -> 1,0,NORTH
+0012 2:1    BOGUS        [ ] error: unknown word 'BOGUS'
+`,
+		},
+		{
+			TRACE_JSON,
+			`{"offset":0,"line":1,"col":1,"depth":0,"push":"1","stack":["1"]}
+{"offset":3,"line":1,"col":3,"depth":0,"push":"0","stack":["1","0"]}
+{"offset":6,"line":1,"col":5,"depth":0,"push":"NORTH","stack":["1","0","NORTH"]}
+{"offset":9,"line":1,"col":11,"depth":0,"word":"PLACE","stack":[],"from":{"x":0,"y":0,"f":"NORTH","placed":false},"to":{"x":1,"y":0,"f":"NORTH","placed":true}}
+{"offset":12,"line":2,"col":1,"depth":0,"word":"BOGUS","stack":[],"error":"unknown word 'BOGUS'"}
+`,
+		},
+	}
+
+	for _, tst := range table {
+		var trace bytes.Buffer
+		robot := NewRobot()
+		robot.Trace = &trace
+		robot.TraceFormat = tst.format
+		err := robot.RunProgram("1 0 NORTH PLACE\nBOGUS")
+		if err == nil {
+			t.Errorf("Expected error running unknown word")
+		}
+		if diff := cmp.Diff(tst.want, trace.String()); diff != "" {
+			t.Errorf("Trace mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestErrorTypes(t *testing.T) {
+	var typeErr *TypeMismatchError
+	var unknownErr *UnknownWordError
+	var compileErr *CompileError
+	var thrownErr *ThrownError
+	var assertErr *AssertionError
+	var rangeErr *RangeError
+	var indexErr *IndexError
+	var conversionErr *ConversionError
+	var divisionErr *DivisionByZeroError
+
+	table := []struct {
+		program string
+		check   func(error) bool
+	}{
+		{"DROP", func(err error) bool { return errors.Is(err, ErrStackUnderflow) }},
+		{"1 \"a\" +", func(err error) bool {
+			return errors.As(err, &typeErr) && typeErr.Word == "+" &&
+				cmp.Equal(typeErr.Expected, []RobotType{T_INT}) && typeErr.Actual == T_STRING
+		}},
+		{"TRUE TRUE +", func(err error) bool {
+			return errors.As(err, &typeErr) && cmp.Equal(typeErr.Expected, []RobotType{T_INT, T_STRING}) &&
+				typeErr.Actual == T_BOOL && err.Error() == "expected T_INT or T_STRING for +, got T_BOOL"
+		}},
+		{"1 IF THEN", func(err error) bool { return errors.As(err, &typeErr) && typeErr.Word == "IF" }},
+		{"1 2 FROB", func(err error) bool { return errors.As(err, &unknownErr) && unknownErr.Word == "FROB" }},
+		{"1 2\n  THEN", func(err error) bool {
+			return errors.As(err, &compileErr) && compileErr.Pos == Position{2, 3} && err.Error() == "2:3: THEN without IF"
+		}},
+		{"TRUE IF 1", func(err error) bool {
+			return errors.As(err, &compileErr) && err.Error() == "1:6: IF without THEN"
+		}},
+		{"1 { 2 } }", func(err error) bool {
+			return errors.As(err, &compileErr) && err.Error() == "1:9: unmatched }"
+		}},
+		{"1 { 2 ELSE }", func(err error) bool {
+			return errors.As(err, &compileErr) && err.Error() == "1:7: ELSE without IF"
+		}},
+		{"1 \x01", func(err error) bool { return errors.As(err, &compileErr) && compileErr.Pos == Position{1, 3} }},
+		{"[ 1 ] THROW", func(err error) bool {
+			return errors.As(err, &thrownErr) && thrownErr.Value.Type == T_LIST
+		}},
+		{"\"abc\" 1 9223372036854775807 SUBSTR", func(err error) bool {
+			return errors.As(err, &rangeErr) && rangeErr.Word == "SUBSTR" && rangeErr.Length == 3 &&
+				err.Error() == "substring 1 9223372036854775807 out of range for string of length 3"
+		}},
+		{"[ 1 2 ] 2 NTH", func(err error) bool {
+			return errors.As(err, &indexErr) && indexErr.Word == "NTH" && indexErr.Index == 2 && indexErr.Length == 2
+		}},
+		{"\"12x\" >NUM", func(err error) bool {
+			return errors.As(err, &conversionErr) && conversionErr.Word == ">NUM" && conversionErr.Value == "12x"
+		}},
+		{"1 0 /", func(err error) bool {
+			return errors.As(err, &divisionErr) && divisionErr.Word == "/" && err.Error() == "division by zero in /"
+		}},
+		{"1 0 MOD", func(err error) bool { return errors.As(err, &divisionErr) && divisionErr.Word == "MOD" }},
+		{"1 ]", func(err error) bool { return errors.Is(err, ErrUnmatchedList) }},
+		{"1 [ 2 DROP DROP ]", func(err error) bool { return errors.Is(err, ErrListUnderflow) }},
+		{"\"x\" \"%d\" FMT", func(err error) bool {
+			return errors.As(err, &typeErr) && typeErr.Word == "FMT" && typeErr.Actual == T_STRING
+		}},
+		{"1 \"%[0]d\" FMT", func(err error) bool { return err.Error() == `bad argument index in format "%[0]d"` }},
+		{"FALSE ASSERT", func(err error) bool { return errors.As(err, &assertErr) && assertErr.Pos == Position{1, 7} }},
+	}
+
+	for _, tst := range table {
+		robot := NewRobot()
+		err := robot.RunProgram(tst.program)
+		if err == nil || !tst.check(err) {
+			t.Errorf("Unexpected error running %q: %v", tst.program, err)
+		}
+	}
+	// A bad facing can't be written in a program, only pushed from Go
+	robot := NewRobot()
+	robot.RobotValueStack.Push(RobotValue{Type: T_INT, Value: 0})
+	robot.RobotValueStack.Push(RobotValue{Type: T_INT, Value: 0})
+	robot.RobotValueStack.Push(RobotValue{Type: T_DIRECTION, Value: Direction(9)})
+	var facingErr *InvalidFacingError
+	if err := robot.place(); !errors.As(err, &facingErr) || facingErr.Facing != 9 {
+		t.Errorf("Expected invalid facing error, got %v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	robot := NewRobot()
+	robot.MaxInstructions = 100
+	err := robot.RunProgram("TRY 1000 { 1 DROP } TIMES CATCH ENDTRY")
+	var instructionErr *InstructionLimitError
+	if !errors.As(err, &instructionErr) || instructionErr.Limit != 100 {
+		t.Errorf("Expected instruction limit error, got %v", err)
+	}
+	err = robot.RunProgram("10 { 1 DROP } TIMES")
+	if err != nil {
+		t.Errorf("Instruction count should reset between programs, got %v", err)
+	}
+
+	robot = NewRobot()
+	robot.MaxStackDepth = 10
+	err = robot.RunProgram("100 { 1 } TIMES")
+	var stackErr *StackLimitError
+	if !errors.As(err, &stackErr) || stackErr.Limit != 10 {
+		t.Errorf("Expected stack limit error, got %v", err)
+	}
+
+	// Each of these goes past the limit with its last instruction
+	for _, program := range []string{"1 2 3", "\"a b c d\" \" \" SPLIT", "1 2 TRY DROP \"x\" THROW CATCH ENDTRY"} {
+		robot = NewRobot()
+		robot.MaxStackDepth = 2
+		err = robot.RunProgram(program)
+		if !errors.As(err, &stackErr) {
+			t.Errorf("Expected stack limit error from %q, got %v", program, err)
+		}
+	}
+
+	// Each of these would take far more memory than the other limits allow
+	// for without MaxValueSize
+	for _, program := range []string{
+		`"a" 26 { DUP + } TIMES`,
+		`[ ] 26 { DUP APPEND } TIMES`,
+		`1 26 { [ DUP DUP ] SWAP DROP } TIMES >STR`,
+		`"x" 9 { DUP + } TIMES [ 1 2 3 ] { DROP DUP } MAP`,
+	} {
+		robot = NewRobot()
+		robot.MaxInstructions = 1000
+		robot.MaxStackDepth = 16
+		robot.MaxValueSize = 1000
+		err = robot.RunProgram(program)
+		var valueErr *ValueLimitError
+		if !errors.As(err, &valueErr) || valueErr.Limit != 1000 {
+			t.Errorf("Expected value size limit error from %q, got %v", program, err)
+		}
+	}
+
+	robot = NewRobot()
+	ctx, cancel := context.WithCancel(context.Background())
+	robot.Dictionary["STOP"] = func() error {
+		cancel()
+		return nil
+	}
+	err = robot.RunProgramContext(ctx, "1000000 { } TIMES STOP 1000000 { } TIMES")
+	var cancelledErr *CancelledError
+	if !errors.As(err, &cancelledErr) || !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancelled error, got %v", err)
+	}
+}
+
 func TestWholePrograms(t *testing.T) {
 	testEnts, err := programs.ReadDir("programs")
 	if err != nil {
 		t.Fatalf("Error reading test programs: %s", err)
 	}
 
-	var table []struct {
-		program        string
-		expectedOutput string
-		fname          string
-	}
 	for _, testEnt := range testEnts {
 		name := fmt.Sprintf("programs/%s", testEnt.Name())
 		contentBytes, err := programs.ReadFile(name)
 		if err != nil {
 			t.Errorf("Error reading test program %s: %s", testEnt.Name(), err)
 		}
-		content := string(contentBytes)
-		parts := strings.Split(content, "### OUTPUT ###\n")
-		program := parts[0]
-		var outputSB strings.Builder
-		for _, line := range strings.Split(parts[1], "\n") {
-			line = strings.TrimPrefix(line, "# ")
-			outputSB.WriteString(line)
-			outputSB.WriteString("\n")
-		}
-		table = append(table, struct {
-			program        string
-			expectedOutput string
-			fname          string
-		}{
-			program,
-			outputSB.String(),
-			testEnt.Name(),
-		})
+		got, want, ok, err := RunGolden(string(contentBytes))
+		if !ok {
+			t.Fatalf("Program '%s' has no expected output", testEnt.Name())
+		}
+		if err != nil {
+			t.Fatalf("Error reading program '%s': %s", testEnt.Name(), err)
+		}
+
+		if diff := cmp.Diff(GoldenLines(want), GoldenLines(got)); diff != "" {
+			t.Errorf("Program output mismatch for '%s' (-want +got):\n%s", testEnt.Name(), diff)
+		}
 	}
+}
 
-	for _, tst := range table {
+func TestWholeProgramsOptimised(t *testing.T) {
+	testEnts, err := programs.ReadDir("programs")
+	if err != nil {
+		t.Fatalf("Error reading test programs: %s", err)
+	}
+
+	for _, testEnt := range testEnts {
+		name := fmt.Sprintf("programs/%s", testEnt.Name())
+		contentBytes, err := programs.ReadFile(name)
+		if err != nil {
+			t.Errorf("Error reading test program %s: %s", testEnt.Name(), err)
+		}
+		program, want, _ := SplitGolden(string(contentBytes))
 		var buffer bytes.Buffer
 		robot := NewRobot()
 		robot.Output = &buffer
-		err := robot.RunProgram(tst.program)
+		robot.Optimise = true
+		err = robot.RunProgram(program)
 		if err != nil {
-			t.Fatalf("Error reading program '%s': %s", tst.fname, err)
+			t.Fatalf("Error running optimised program '%s': %s", testEnt.Name(), err)
 		}
 
-		wantLines := strings.Split(strings.TrimSpace(tst.expectedOutput), "\n")
-		gotLines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+		if diff := cmp.Diff(GoldenLines(want), GoldenLines(buffer.String())); diff != "" {
+			t.Errorf("Optimised program output mismatch for '%s' (-want +got):\n%s", testEnt.Name(), diff)
+		}
+	}
+}
 
-		if diff := cmp.Diff(wantLines, gotLines); diff != "" {
-			t.Errorf("Program output mismatch for '%s' (-want +got):\n%s", tst.fname, diff)
+func TestUpdateGolden(t *testing.T) {
+	table := []struct {
+		content, output, want string
+	}{
+		{"1 .\n", "1\n", "1 .\n### OUTPUT ###\n# 1\n"},
+		{"1 .", "1\n", "1 .\n### OUTPUT ###\n# 1\n"},
+		{"1 . cr 2 .\n### OUTPUT ###\n# 3\n", "1\n\n2\n", "1 . cr 2 .\n### OUTPUT ###\n# 1\n# \n# 2\n"},
+	}
+
+	for _, tst := range table {
+		got := UpdateGolden(tst.content, tst.output)
+		if diff := cmp.Diff(tst.want, got); diff != "" {
+			t.Errorf("UpdateGolden(%q, %q) mismatch (-want +got):\n%s", tst.content, tst.output, diff)
 		}
 	}
 }
+
+func BenchmarkRunProgram(b *testing.B) {
+	table := []struct {
+		name    string
+		program string
+	}{
+		{"arithmetic", "200 { 1 2 + 3 * DROP } TIMES"},
+		{"robot", "0 0 NORTH PLACE 200 { MOVE RIGHT MOVE LEFT LEFT LEFT } TIMES"},
+		{"conditional", "200 { 5 DUP 3 > IF 1 + ELSE 1 - THEN DROP } TIMES"},
+	}
+
+	for _, bm := range table {
+		b.Run(bm.name, func(b *testing.B) {
+			robot := NewRobot()
+			for i := 0; i < b.N; i++ {
+				err := robot.RunProgram(bm.program)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestWordDocs(t *testing.T) {
+	for word := range NewRobot().Dictionary {
+		if _, ok := WordDocs[word]; !ok {
+			t.Errorf("%s has no entry in WordDocs", word)
+		}
+	}
+}
+
+func TestTrail(t *testing.T) {
+	robot := NewRobot()
+	robot.Output = io.Discard
+	err := robot.RunProgram("MOVE 0 0 NORTH PLACE MOVE MOVE RIGHT MOVE 4 4 NORTH PLACE MOVE LEFT LEFT MOVE MOVE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Trail{
+		Squares: []Point{{4, 4}, {4, 3}, {4, 2}},
+		Edges:   []Edge{{Point{4, 3}, Point{4, 4}}, {Point{4, 2}, Point{4, 3}}},
+	}
+	if diff := cmp.Diff(want, robot.Trail); diff != "" {
+		t.Errorf("trail mismatch (-want +got):\n%s", diff)
+	}
+
+	// Going back and forth doesn't grow the trail
+	err = robot.RunProgram("0 0 NORTH PLACE 2000 { MOVE MOVE MOVE MOVE RIGHT RIGHT } TIMES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(robot.Trail.Squares) != BoardSize || len(robot.Trail.Edges) != BoardSize-1 {
+		t.Errorf("patrol left a trail of %d squares and %d edges, want %d and %d",
+			len(robot.Trail.Squares), len(robot.Trail.Edges), BoardSize, BoardSize-1)
+	}
+}
+
+func TestRenderBoard(t *testing.T) {
+	robot := NewRobot()
+	robot.Output = io.Discard
+	err := robot.RunProgram("0 0 NORTH PLACE MOVE RIGHT MOVE MOVE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"┌───┬───┬───┬───┬───┐",
+		"│   │   │   │   │   │",
+		"├───┼───┼───┼───┼───┤",
+		"│   │   │   │   │   │",
+		"├───┼───┼───┼───┼───┤",
+		"│   │   │   │   │   │",
+		"├───┼───┼───┼───┼───┤",
+		"│ · │ · │ → │   │   │",
+		"├───┼───┼───┼───┼───┤",
+		"│ · │   │   │   │   │",
+		"└───┴───┴───┴───┴───┘",
+	}, "\n") + "\n"
+	if diff := cmp.Diff(want, robot.RenderBoard(BOARD_UNICODE, false)); diff != "" {
+		t.Errorf("board mismatch (-want +got):\n%s", diff)
+	}
+
+	coloured := robot.RenderBoard(BOARD_UNICODE, true)
+	if !strings.Contains(coloured, ansiRobot+"→"+ansiReset) || !strings.Contains(coloured, ansiTrail+"·"+ansiReset) {
+		t.Errorf("robot and trail should be coloured:\n%s", coloured)
+	}
+
+	// BOARD-STYLE changes the style, but output that isn't a terminal
+	// still gets ASCII
+	var buffer bytes.Buffer
+	robot.Output = &buffer
+	err = robot.RunProgram("\"unicode\" BOARD-STYLE BOARD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if robot.BoardStyle != BOARD_UNICODE {
+		t.Errorf("BoardStyle = %d, want BOARD_UNICODE", robot.BoardStyle)
+	}
+	if diff := cmp.Diff(robot.RenderBoard(BOARD_ASCII, false), buffer.String()); diff != "" {
+		t.Errorf("board mismatch (-want +got):\n%s", diff)
+	}
+	if err := robot.RunProgram("\"fancy\" BOARD-STYLE"); err == nil {
+		t.Error("expected an error for an unknown style")
+	}
+}
@@ -0,0 +1,101 @@
+package toyrobot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type TraceFormat byte
+
+const (
+	TRACE_TEXT TraceFormat = iota
+	TRACE_JSON
+)
+
+// robotState is a snapshot of the robot used to spot moves when tracing.
+type robotState struct {
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	F      string `json:"f"`
+	Placed bool   `json:"placed"`
+}
+
+func (r *Robot) snapshot() robotState {
+	return robotState{X: r.X, Y: r.Y, F: r.F.String(), Placed: r.Placed}
+}
+
+type traceLine struct {
+	Offset int         `json:"offset"`
+	Line   int         `json:"line,omitempty"`
+	Col    int         `json:"col,omitempty"`
+	Depth  int         `json:"depth"`
+	Word   string      `json:"word,omitempty"`
+	Push   string      `json:"push,omitempty"`
+	Stack  []string    `json:"stack"`
+	From   *robotState `json:"from,omitempty"`
+	To     *robotState `json:"to,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// trace writes a line to r.Trace describing an instruction that has just
+// run, given the robot as it was before the instruction.
+func (r *Robot) trace(step Step, before robotState, err error) {
+	line := traceLine{
+		Offset: step.Offset,
+		Depth:  step.Depth,
+		Word:   step.Word,
+		Stack:  make([]string, len(*r.RobotValueStack)),
+	}
+	if step.HasPos {
+		line.Line, line.Col = step.Pos.Line, step.Pos.Col
+	}
+	if step.Op == OP_PUSH_VAL {
+		line.Push = step.Value.Literal()
+	}
+	for i, v := range *r.RobotValueStack {
+		line.Stack[i] = v.Literal()
+	}
+	if after := r.snapshot(); after != before {
+		line.From, line.To = &before, &after
+	}
+	if err != nil {
+		line.Error = err.Error()
+	}
+
+	if r.TraceFormat == TRACE_JSON {
+		b, _ := json.Marshal(line)
+		fmt.Fprintf(r.Trace, "%s\n", b)
+		return
+	}
+
+	what := line.Word
+	if step.Op == OP_PUSH_VAL {
+		what = line.Push
+	}
+	pos := ""
+	if step.HasPos {
+		pos = step.Pos.String()
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%04d %-6s %s%-12s [ ", step.Offset, pos, strings.Repeat("  ", step.Depth), what)
+	for _, v := range line.Stack {
+		sb.WriteString(v)
+		sb.WriteString(" ")
+	}
+	sb.WriteString("]")
+	if line.From != nil {
+		fmt.Fprintf(&sb, " robot %s -> %s", before.describe(), line.To.describe())
+	}
+	if err != nil {
+		fmt.Fprintf(&sb, " error: %s", err)
+	}
+	fmt.Fprintln(r.Trace, sb.String())
+}
+
+func (s robotState) describe() string {
+	if !s.Placed {
+		return "not placed"
+	}
+	return fmt.Sprintf("%d,%d,%s", s.X, s.Y, s.F)
+}
@@ -1,5 +1,10 @@
 package toyrobot
 
+import (
+	"fmt"
+	"strings"
+)
+
 //go:generate stringer -type=RobotType
 type RobotType byte
 
@@ -8,13 +13,55 @@ const (
 	T_DIRECTION
 	T_BOOL
 	T_STRING
+	T_LIST
+	T_QUOTE
 )
 
+// Quotation is a block of compiled code that can be run later with CALL.
+type Quotation struct {
+	Code   []byte
+	Source string
+
+	// Where the code sits in the program it was compiled from, so that
+	// positions can be found in that program's source map.
+	sourceMap map[int]Position
+	base      int
+}
+
 type RobotValue struct {
 	Type  RobotType
 	Value any
 }
 
+// String renders the value the way `.` prints it.
+func (v RobotValue) String() string {
+	if v.Type == T_LIST || v.Type == T_QUOTE {
+		return v.Literal()
+	}
+	return fmt.Sprint(v.Value)
+}
+
+// Literal renders the value in a form the tokeniser can read back.
+func (v RobotValue) Literal() string {
+	switch v.Type {
+	case T_STRING:
+		return quoteString(v.Value.(string))
+	case T_QUOTE:
+		return fmt.Sprintf("{ %s }", v.Value.(Quotation).Source)
+	case T_LIST:
+		var sb strings.Builder
+		sb.WriteString("[ ")
+		for _, el := range v.Value.([]RobotValue) {
+			sb.WriteString(el.Literal())
+			sb.WriteString(" ")
+		}
+		sb.WriteString("]")
+		return sb.String()
+	default:
+		return fmt.Sprint(v.Value)
+	}
+}
+
 //go:generate stringer -type=Direction
 type Direction byte
 
@@ -0,0 +1,61 @@
+package toyrobot
+
+import "fmt"
+
+// WordTable gives every word name used by compiled code a number, so that
+// code can refer to words by index instead of by name.
+type WordTable struct {
+	names []string
+	index map[string]int
+}
+
+func NewWordTable() *WordTable {
+	return &WordTable{index: make(map[string]int)}
+}
+
+// Intern returns the index for a word, adding it to the table if needed.
+func (w *WordTable) Intern(name string) (int, error) {
+	if i, ok := w.index[name]; ok {
+		return i, nil
+	}
+	if len(w.names) > 0xffff {
+		return 0, fmt.Errorf("too many words")
+	}
+	w.names = append(w.names, name)
+	w.index[name] = len(w.names) - 1
+	return len(w.names) - 1, nil
+}
+
+// Name returns the word with the given index.
+func (w *WordTable) Name(i int) string {
+	if i < 0 || i >= len(w.names) {
+		return ""
+	}
+	return w.names[i]
+}
+
+func (w *WordTable) Len() int {
+	return len(w.names)
+}
+
+// bindWords looks up every word in the table in the dictionary, so that
+// running a word doesn't need a map lookup. Words that aren't defined yet
+// are left unbound and looked up when they are run.
+func (r *Robot) bindWords() {
+	words := r.RobotCompiler.Words
+	for i := len(r.bound); i < words.Len(); i++ {
+		r.bound = append(r.bound, nil)
+	}
+	for i := range r.bound {
+		r.bound[i] = r.Dictionary[words.Name(i)]
+	}
+}
+
+// lookup returns the function for a word index.
+func (r *Robot) lookup(i int) (func() error, bool) {
+	if i < len(r.bound) && r.bound[i] != nil {
+		return r.bound[i], true
+	}
+	fn, ok := r.Dictionary[r.RobotCompiler.Words.Name(i)]
+	return fn, ok
+}
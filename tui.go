@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/danwhitford/toyrobot/toyrobot"
+)
+
+// Widths in characters of the stack and output columns
+const (
+	stackWidth  = 24
+	outputWidth = 48
+)
+
+const clearScreen = "\x1b[H\x1b[2J"
+
+// tui shows the board, the stack and what the program has printed, redrawn
+// after every line typed in.
+type tui struct {
+	robot  *toyrobot.Robot
+	in     *bufio.Scanner
+	out    io.Writer
+	colour bool
+
+	// Everything printed so far, with the line still being printed last
+	log []string
+}
+
+func runTUI(r *toyrobot.Robot, args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: toyrobot tui")
+		return 2
+	}
+	t := newTUI(r, os.Stdin, os.Stdout)
+	t.colour = os.Getenv("NO_COLOR") == ""
+	t.run()
+	return 0
+}
+
+// newTUI makes a tui that catches what the robot prints.
+func newTUI(r *toyrobot.Robot, in io.Reader, out io.Writer) *tui {
+	t := &tui{
+		robot: r,
+		in:    bufio.NewScanner(in),
+		out:   out,
+		log:   []string{""},
+	}
+	r.Output = t
+	return t
+}
+
+func (t *tui) run() {
+	for {
+		fmt.Fprint(t.out, clearScreen+t.render())
+		if !t.in.Scan() {
+			fmt.Fprintln(t.out)
+			return
+		}
+		line := t.in.Text()
+		if strings.TrimSpace(line) == "quit" {
+			return
+		}
+		err := t.robot.RunProgram(line)
+		if err != nil {
+			t.Write([]byte(fmt.Sprintf("error: %s\n", err)))
+		}
+	}
+}
+
+// Write adds what the program prints to the log.
+func (t *tui) Write(p []byte) (int, error) {
+	lines := strings.Split(string(p), "\n")
+	t.log[len(t.log)-1] += lines[0]
+	t.log = append(t.log, lines[1:]...)
+	return len(p), nil
+}
+
+// render draws the three columns and the prompt. The board is drawn in the
+// robot's BoardStyle, so -board and BOARD-STYLE both change it.
+func (t *tui) render() string {
+	board := strings.Split(strings.TrimSuffix(t.robot.RenderBoard(t.robot.BoardStyle, t.colour), "\n"), "\n")
+	board = append(board, t.robotState())
+	height := len(board)
+
+	var sb strings.Builder
+	columns := []struct {
+		title string
+		lines []string
+		width int
+	}{
+		{"Board", board, visibleWidth(board[0])},
+		{"Stack", t.stackLines(height), stackWidth},
+		{"Output", t.outputLines(height), outputWidth},
+	}
+	for row := -1; row < height; row++ {
+		cells := make([]string, len(columns))
+		for i, col := range columns {
+			var cell string
+			switch {
+			case row < 0:
+				cell = col.title
+			case row < len(col.lines):
+				cell = col.lines[row]
+			}
+			cells[i] = pad(cell, col.width)
+		}
+		sb.WriteString(strings.TrimRight(strings.Join(cells, "  "), " ") + "\n")
+	}
+	sb.WriteString("\nType code to run it, or quit.\n> ")
+	return sb.String()
+}
+
+func (t *tui) robotState() string {
+	r := t.robot
+	if !r.Placed {
+		return "not placed"
+	}
+	return fmt.Sprintf("%d,%d,%s", r.X, r.Y, r.F)
+}
+
+// stackLines is the stack top first, as much of it as fits in height lines.
+func (t *tui) stackLines(height int) []string {
+	stack := *t.robot.RobotValueStack
+	var lines []string
+	for i := len(stack) - 1; i >= 0; i-- {
+		if len(lines) == height-1 && i > 0 {
+			lines = append(lines, fmt.Sprintf("... %d more", i+1))
+			break
+		}
+		lines = append(lines, truncate(stack[i].Literal(), stackWidth))
+	}
+	return lines
+}
+
+// outputLines is the end of the log, as much of it as fits in height lines.
+func (t *tui) outputLines(height int) []string {
+	log := t.log
+	if log[len(log)-1] == "" {
+		log = log[:len(log)-1]
+	}
+	if len(log) > height {
+		log = log[len(log)-height:]
+	}
+	lines := make([]string, len(log))
+	for i, line := range log {
+		lines[i] = truncate(line, outputWidth)
+	}
+	return lines
+}
+
+// visibleWidth is how many characters s takes up on screen, skipping ANSI
+// colour escapes.
+func visibleWidth(s string) int {
+	width := 0
+	inEscape := false
+	for _, c := range s {
+		switch {
+		case inEscape:
+			inEscape = c != 'm'
+		case c == '\x1b':
+			inEscape = true
+		default:
+			width++
+		}
+	}
+	return width
+}
+
+func pad(s string, width int) string {
+	if n := visibleWidth(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// truncate shortens plain text to fit in width characters.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width-3]) + "..."
+}
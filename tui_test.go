@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/danwhitford/toyrobot/toyrobot"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTUIWrite(t *testing.T) {
+	tu := newTUI(toyrobot.NewRobot(), nil, nil)
+	for _, s := range []string{"a", "b\nc\n", "d"} {
+		tu.Write([]byte(s))
+	}
+	if diff := cmp.Diff([]string{"ab", "c", "d"}, tu.log); diff != "" {
+		t.Errorf("log mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTUIRender(t *testing.T) {
+	r := toyrobot.NewRobot()
+	tu := newTUI(r, nil, nil)
+	err := r.RunProgram(`0 0 NORTH PLACE MOVE 1 "a long string that won't fit" "hi" . 2 .`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Board                  Stack                     Output
++---+---+---+---+---+  "a long string that w...  hi
+|   |   |   |   |   |  1                         2
++---+---+---+---+---+
+|   |   |   |   |   |
++---+---+---+---+---+
+|   |   |   |   |   |
++---+---+---+---+---+
+| ^ |   |   |   |   |
++---+---+---+---+---+
+|   |   |   |   |   |
++---+---+---+---+---+
+0,1,NORTH
+
+Type code to run it, or quit.
+> `
+	if diff := cmp.Diff(want, tu.render()); diff != "" {
+		t.Errorf("render mismatch (-want +got):\n%s", diff)
+	}
+
+	// -board and BOARD-STYLE change how the board is drawn
+	r.BoardStyle = toyrobot.BOARD_UNICODE
+	if got := tu.render(); !strings.Contains(got, "│ ↑ │") {
+		t.Errorf("unicode board not drawn:\n%s", got)
+	}
+}
+
+func TestTUIColumns(t *testing.T) {
+	r := toyrobot.NewRobot()
+	tu := newTUI(r, nil, nil)
+	for i := 1; i <= 6; i++ {
+		r.RunProgram(fmt.Sprintf("%d DUP .", i))
+	}
+	if diff := cmp.Diff([]string{"6", "5", "... 4 more"}, tu.stackLines(3)); diff != "" {
+		t.Errorf("stack mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"4", "5", "6"}, tu.outputLines(3)); diff != "" {
+		t.Errorf("output mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTUIRun(t *testing.T) {
+	var out bytes.Buffer
+	in := strings.NewReader("0 0 EAST PLACE\nMOVE\nOOPS\nquit\nMOVE\n")
+	r := toyrobot.NewRobot()
+	newTUI(r, in, &out).run()
+
+	screens := strings.Split(out.String(), clearScreen)[1:]
+	if len(screens) != 4 {
+		t.Fatalf("drew %d screens, want one before each line up to quit", len(screens))
+	}
+	last := screens[len(screens)-1]
+	for _, want := range []string{"1,0,EAST", "error: unknown word 'OOPS'"} {
+		if !strings.Contains(last, want) {
+			t.Errorf("last screen should show %q:\n%s", want, last)
+		}
+	}
+	if r.X != 1 {
+		t.Errorf("lines after quit were run: robot at %d,%d", r.X, r.Y)
+	}
+}